@@ -39,31 +39,67 @@ import (
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/ory/ladon"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
+// ErrNotAllowed is the cause of the ErrDenied returned when a request is denied
+var ErrNotAllowed = errors.New("not allowed")
+
+// Warden decides if a subject has the permission to perform an action on a resource.
+// It returns an ErrDenied if the request is denied, and other errors, usually an ErrUnavailable,
+// if it couldn't decide.
+// Authorizer, CachedAuthorizer and Local implement it, and AllowAll, DenyAll and Recorder
+// can replace them in the tests.
+type Warden interface {
+	IsAllowed(ctx context.Context, request *ladon.Request) error
+}
+
 // Authorizer uses hydra rest apis to retrieve clients
 type Authorizer struct {
 	AllowedEndpoint *url.URL
+	HealthEndpoint  *url.URL
 	Client          *http.Client
+
+	// Concurrency is how many requests of a batch are sent to hydra at the same time.
+	// Zero means DefaultConcurrency.
+	Concurrency int
 }
 
 // NewAuthorizer returns a Warden authorizer connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewAuthorizer(id, secret, cluster string) (*Authorizer, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewAuthorizerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewAuthorizerWithOptions returns an Authorizer connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewAuthorizerWithOptions(cluster string, opts ...common.Option) (*Authorizer, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate Authorizer")
 	}
 
 	manager := Authorizer{
 		AllowedEndpoint: common.JoinURL(endpoint, "warden", "allowed"),
+		HealthEndpoint:  common.JoinURL(endpoint, "health", "status"),
 		Client:          client,
 	}
 	return &manager, nil
 }
 
-// IsAllowed calls the hydra endpoint to see if a subject has the permission to perform an action
-func (m *Authorizer) IsAllowed(request *ladon.Request) error {
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Authorizer) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
+// IsAllowed calls the hydra endpoint to see if a subject has the permission to perform an action.
+// It returns an ErrDenied if the subject doesn't have the permission, an ErrUnavailable
+// if hydra couldn't answer, and other errors if hydra rejected the request or the credentials.
+func (m *Authorizer) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	if request == nil {
+		return errNilRequest
+	}
+
 	data, err := json.Marshal(&request)
 	if err != nil {
 		return errors.Wrapf(err, "marshal request")
@@ -74,6 +110,7 @@ func (m *Authorizer) IsAllowed(request *ladon.Request) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Content-Length", strconv.Itoa(len(data)))
@@ -83,12 +120,34 @@ func (m *Authorizer) IsAllowed(request *ladon.Request) error {
 	}
 	err = common.Bind(m.Client, req, &res)
 	if err != nil {
-		return err
+		return failure(err, "ask the warden")
 	}
 
 	if !res.Allowed {
-		return errors.New("not allowed")
+		return denied(request)
 	}
 
 	return nil
 }
+
+// IsAllowedCtx is like IsAllowed, which now takes the context too.
+//
+// Deprecated: use IsAllowed.
+func (m *Authorizer) IsAllowedCtx(ctx context.Context, request *ladon.Request) error {
+	return m.IsAllowed(ctx, request)
+}
+
+// Decide is like IsAllowed, but a denied request is not an error: see the Decide function
+func (m *Authorizer) Decide(ctx context.Context, request *ladon.Request) (bool, error) {
+	return Decide(ctx, m, request)
+}
+
+// IsAllowedBatch asks hydra about many requests concurrently: see the IsAllowedBatch function
+func (m *Authorizer) IsAllowedBatch(ctx context.Context, requests []*ladon.Request) ([]Decision, error) {
+	return IsAllowedBatch(ctx, m, m.Concurrency, requests)
+}
+
+// FilterAllowed returns the resources on which the subject can perform the action: see the FilterAllowed function
+func (m *Authorizer) FilterAllowed(ctx context.Context, subject, action string, resources []string) ([]string, error) {
+	return FilterAllowed(ctx, m, m.Concurrency, subject, action, resources)
+}
@@ -0,0 +1,168 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+)
+
+func TestIsAllowed(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupManager, err := groups.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyManager.Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"me", "hungry"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana", "cake"},
+	})
+	policyManager.Create(&policies.Policy{
+		ID:        "diet",
+		Subjects:  []string{"my-friend"},
+		Effect:    "deny",
+		Actions:   []string{"eat"},
+		Resources: []string{"cake"},
+	})
+	groupManager.Create(&groups.Group{
+		ID:      "hungry",
+		Members: []string{"my-friend"},
+	})
+
+	cases := []struct {
+		subject  string
+		resource string
+		allowed  bool
+	}{
+		{"me", "banana", true},
+		{"me", "cake", true},
+		{"me", "apple", false},
+		{"stranger", "banana", false},
+		{"my-friend", "banana", true},
+		{"my-friend", "cake", false},
+	}
+
+	for _, tc := range cases {
+		err := warden.IsAllowed(ctx, &ladon.Request{Subject: tc.subject, Action: "eat", Resource: tc.resource})
+		if tc.allowed && err != nil {
+			t.Errorf("Expected %s to eat %s, got %s", tc.subject, tc.resource, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Errorf("Expected %s not to eat %s", tc.subject, tc.resource)
+		}
+	}
+
+	// The deprecated IsAllowedCtx still works
+	if err := warden.IsAllowedCtx(ctx, &ladon.Request{Subject: "me", Action: "eat", Resource: "banana"}); err != nil {
+		t.Errorf("Expected IsAllowedCtx to allow me to eat banana, got %s", err)
+	}
+
+	calls := server.Calls("/warden/allowed")
+	if err := warden.IsAllowed(ctx, nil); err == nil || authorizer.IsDenied(err) {
+		t.Errorf("Expected an error for a nil request, got %v", err)
+	}
+	if server.Calls("/warden/allowed") != calls {
+		t.Error("Expected a nil request not to be sent to hydra")
+	}
+}
+
+func TestCachedAuthorizer(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyManager.Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"me"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana"},
+	})
+
+	cached := authorizer.NewCachedAuthorizer(warden, 2, time.Minute, time.Minute)
+
+	allowed := &ladon.Request{Subject: "me", Action: "eat", Resource: "banana"}
+	denied := &ladon.Request{Subject: "me", Action: "eat", Resource: "cake"}
+	withContext := &ladon.Request{Subject: "me", Action: "eat", Resource: "cake", Context: ladon.Context{"hungry": true}}
+
+	for i := 0; i < 3; i++ {
+		if err := cached.IsAllowed(ctx, allowed); err != nil {
+			t.Errorf("Expected to be allowed, got %s", err)
+		}
+		if err := cached.IsAllowed(ctx, denied); !authorizer.IsDenied(err) {
+			t.Errorf("Expected a denial, got %v", err)
+		}
+	}
+
+	if calls := server.Calls("/warden/allowed"); calls != 2 {
+		t.Errorf("Expected 2 calls to hydra, got %d", calls)
+	}
+	if stats := cached.Stats(); stats.Hits != 4 || stats.Misses != 2 {
+		t.Errorf("Expected 4 hits and 2 misses, got %+v", stats)
+	}
+
+	// A different context is a different request, and evicts the least recently used
+	cached.IsAllowed(ctx, withContext)
+	cached.IsAllowed(ctx, allowed)
+	if calls := server.Calls("/warden/allowed"); calls != 4 {
+		t.Errorf("Expected 4 calls to hydra, got %d", calls)
+	}
+}
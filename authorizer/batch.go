@@ -0,0 +1,155 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"sync"
+
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// DefaultConcurrency is how many requests of a batch are checked at the same time, if not specified
+const DefaultConcurrency = 8
+
+// Decision is the answer of the warden to a request of a batch
+type Decision struct {
+	Request *ladon.Request
+	Allowed bool
+}
+
+// IsAllowedBatch asks the warden about all the requests, checking up to concurrency of them
+// at the same time. The identical requests are checked only once. The decisions are in the
+// same order of the requests. If the warden fails to decide on any of them, the remaining
+// ones are abandoned and the error is returned, so that the caller can fail closed.
+// A nil request is an error, and nothing is checked.
+func IsAllowedBatch(ctx context.Context, warden Warden, concurrency int, requests []*ladon.Request) ([]Decision, error) {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	// unique[i] is the index of the first request identical to requests[i]
+	unique := make([]int, len(requests))
+	jobs := []int{}
+	seen := map[string]int{}
+	for i, request := range requests {
+		if request == nil {
+			return nil, errors.Wrapf(errNilRequest, "request %d", i)
+		}
+		key, err := requestKey(request)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := seen[key]; ok {
+			unique[i] = first
+			continue
+		}
+		seen[key] = i
+		unique[i] = i
+		jobs = append(jobs, i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	allowed := make([]bool, len(requests))
+	queue := make(chan int)
+	var once sync.Once
+	var failure error
+	var wg sync.WaitGroup
+
+	if concurrency > len(jobs) {
+		concurrency = len(jobs)
+	}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				ok, err := Decide(ctx, warden, requests[i])
+				if err != nil {
+					once.Do(func() {
+						failure = err
+						cancel()
+					})
+					continue
+				}
+				allowed[i] = ok
+			}
+		}()
+	}
+
+feed:
+	for _, i := range jobs {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if failure != nil {
+		return nil, failure
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	decisions := make([]Decision, len(requests))
+	for i, request := range requests {
+		decisions[i] = Decision{Request: request, Allowed: allowed[unique[i]]}
+	}
+	return decisions, nil
+}
+
+// FilterAllowed returns the resources on which the subject can perform the action,
+// in the same order, checking them with IsAllowedBatch
+func FilterAllowed(ctx context.Context, warden Warden, concurrency int, subject, action string, resources []string) ([]string, error) {
+	requests := make([]*ladon.Request, len(resources))
+	for i, resource := range resources {
+		requests[i] = &ladon.Request{Subject: subject, Action: action, Resource: resource}
+	}
+
+	decisions, err := IsAllowedBatch(ctx, warden, concurrency, requests)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []string{}
+	for _, decision := range decisions {
+		if decision.Allowed {
+			allowed = append(allowed, decision.Request.Resource)
+		}
+	}
+	return allowed, nil
+}
@@ -0,0 +1,193 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// slowWarden allows the resources starting with "public", and keeps track of how many
+// requests it's answering at the same time. The first requests wait until wait of them
+// are in flight, so that the concurrency doesn't depend on the timing.
+type slowWarden struct {
+	wait int
+
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	released chan struct{}
+}
+
+func (w *slowWarden) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	w.mu.Lock()
+	if w.released == nil {
+		w.released = make(chan struct{})
+	}
+	released := w.released
+	w.inFlight++
+	if w.inFlight > w.max {
+		w.max = w.inFlight
+	}
+	if w.inFlight >= w.wait {
+		select {
+		case <-released:
+		default:
+			close(released)
+		}
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		// Not enough concurrent requests: the test fails on max instead of hanging
+	}
+
+	w.mu.Lock()
+	w.inFlight--
+	w.mu.Unlock()
+
+	if request.Resource == "broken" {
+		return &authorizer.ErrUnavailable{Err: errors.New("hydra is down")}
+	}
+	if !strings.HasPrefix(request.Resource, "public") {
+		return authorizer.DenyAll{}.IsAllowed(ctx, request)
+	}
+	return nil
+}
+
+func TestIsAllowedBatch(t *testing.T) {
+	ctx := context.Background()
+	slow := &slowWarden{wait: 3}
+	recorder := &authorizer.Recorder{Warden: slow}
+
+	requests := []*ladon.Request{}
+	for i := 0; i < 20; i++ {
+		resource := "private"
+		if i%2 == 0 {
+			resource = "public"
+		}
+		// Five distinct requests per resource, each repeated twice
+		requests = append(requests, &ladon.Request{Subject: "me", Action: "get", Resource: resource + string(rune('a'+i/4))})
+	}
+
+	decisions, err := authorizer.IsAllowedBatch(ctx, recorder, 3, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != len(requests) {
+		t.Fatalf("Expected %d decisions, got %d", len(requests), len(decisions))
+	}
+	for i, decision := range decisions {
+		if decision.Request != requests[i] {
+			t.Errorf("Expected the decisions in the order of the requests")
+		}
+		if decision.Allowed != strings.HasPrefix(requests[i].Resource, "public") {
+			t.Errorf("Unexpected decision %v for %s", decision.Allowed, requests[i].Resource)
+		}
+	}
+	if n := len(recorder.Requests()); n != 10 {
+		t.Errorf("Expected the identical requests to be checked once, got %d checks", n)
+	}
+	if slow.max != 3 {
+		t.Errorf("Expected 3 concurrent checks, got %d", slow.max)
+	}
+
+	resources := []string{"public1", "private1", "public2", "public1"}
+	allowed, err := authorizer.FilterAllowed(ctx, slow, 0, "me", "get", resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(allowed, ",") != "public1,public2,public1" {
+		t.Errorf("Unexpected allowed resources %v", allowed)
+	}
+
+	// A failure fails the whole batch
+	_, err = authorizer.FilterAllowed(ctx, slow, 2, "me", "get", []string{"public1", "broken", "public2"})
+	if !authorizer.IsUnavailable(err) {
+		t.Errorf("Expected an ErrUnavailable, got %v", err)
+	}
+
+	// A nil request is rejected before asking the warden
+	recorder.Reset()
+	_, err = authorizer.IsAllowedBatch(ctx, recorder, 2, []*ladon.Request{requests[0], nil})
+	if err == nil {
+		t.Error("Expected an error for a nil request")
+	}
+	if n := len(recorder.Requests()); n != 0 {
+		t.Errorf("Expected no checks with a nil request, got %d", n)
+	}
+}
+
+func TestAuthorizerFilterAllowed(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyManager.Create(&policies.Policy{
+		ID:        "read items",
+		Subjects:  []string{"me"},
+		Effect:    "allow",
+		Actions:   []string{"get"},
+		Resources: []string{"rn:api:items:<[0-9]+>"},
+	})
+
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	warden.Concurrency = 4
+
+	resources := []string{"rn:api:items:1", "rn:api:orders:1", "rn:api:items:2", "rn:api:items:1"}
+	allowed, err := warden.FilterAllowed(ctx, "me", "get", resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(allowed, ",") != "rn:api:items:1,rn:api:items:2,rn:api:items:1" {
+		t.Errorf("Unexpected allowed resources %v", allowed)
+	}
+	if calls := server.Calls("/warden/allowed"); calls != 3 {
+		t.Errorf("Expected 3 calls to hydra, got %d", calls)
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// CachedAuthorizer wraps a Warden and keeps its decisions in memory, so that
+// the same request doesn't need to reach hydra every time.
+// Errors other than ErrDenied are never cached.
+type CachedAuthorizer struct {
+	Authorizer Warden
+	// AllowTTL and DenyTTL are how long the allowed and denied decisions are kept.
+	// A zero value disables the caching of that kind of decisions.
+	AllowTTL time.Duration
+	DenyTTL  time.Duration
+
+	cache *common.Cache
+}
+
+// NewCachedAuthorizer returns a CachedAuthorizer that keeps up to size decisions,
+// evicting the least recently used ones
+func NewCachedAuthorizer(authorizer Warden, size int, allowTTL, denyTTL time.Duration) *CachedAuthorizer {
+	return &CachedAuthorizer{
+		Authorizer: authorizer,
+		AllowTTL:   allowTTL,
+		DenyTTL:    denyTTL,
+		cache:      common.NewCache(size),
+	}
+}
+
+// IsAllowed returns the cached decision for the request, asking the wrapped Warden if there's none
+func (c *CachedAuthorizer) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	key, err := requestKey(request)
+	if err != nil {
+		return err
+	}
+
+	if allowed, ok := c.cache.Get(key); ok {
+		if !allowed.(bool) {
+			return denied(request)
+		}
+		return nil
+	}
+
+	err = c.Authorizer.IsAllowed(ctx, request)
+	switch {
+	case err == nil:
+		c.cache.Set(key, true, c.AllowTTL)
+	case IsDenied(err):
+		c.cache.Set(key, false, c.DenyTTL)
+	}
+	return err
+}
+
+// Stats returns the hits and misses of the cache
+func (c *CachedAuthorizer) Stats() common.CacheStats {
+	return c.cache.Stats()
+}
+
+// Purge forgets every cached decision, for example after the policies have changed
+func (c *CachedAuthorizer) Purge() {
+	c.cache.Purge()
+}
+
+// requestKey returns a digest of the whole request, context included
+func requestKey(request *ladon.Request) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", errors.Wrapf(err, "marshal request")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
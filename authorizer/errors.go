@@ -0,0 +1,166 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// ErrDenied is returned by the wardens when the request is denied. Its cause is ErrNotAllowed,
+// so errors.Cause(err) == ErrNotAllowed still works.
+type ErrDenied struct {
+	Subject  string
+	Resource string
+	Action   string
+}
+
+// Error describes the denied request
+func (e *ErrDenied) Error() string {
+	return fmt.Sprintf("%s is not allowed to %s %s", e.Subject, e.Action, e.Resource)
+}
+
+// Cause returns ErrNotAllowed
+func (e *ErrDenied) Cause() error {
+	return ErrNotAllowed
+}
+
+// ErrUnavailable is returned by the wardens when they couldn't decide because of a failure that
+// may go away: hydra is unreachable, or answers with a 5xx or 429 status code. Its cause is the
+// original error. The 4xx answers, like the ones caused by wrong credentials, are not an
+// ErrUnavailable, since retrying doesn't help.
+type ErrUnavailable struct {
+	Err error
+}
+
+// Error describes the failure
+func (e *ErrUnavailable) Error() string {
+	return "authorization unavailable: " + e.Err.Error()
+}
+
+// Cause returns the original error
+func (e *ErrUnavailable) Cause() error {
+	return e.Err
+}
+
+// IsDenied returns true if err means that the request was denied
+func IsDenied(err error) bool {
+	return err != nil && errors.Cause(err) == ErrNotAllowed
+}
+
+// IsUnavailable returns true if err means that the warden couldn't decide
+func IsUnavailable(err error) bool {
+	for err != nil {
+		if _, ok := err.(*ErrUnavailable); ok {
+			return true
+		}
+		causer, ok := err.(interface{ Cause() error })
+		if !ok {
+			return false
+		}
+		err = causer.Cause()
+	}
+	return false
+}
+
+// Decide asks the warden about the request, separating the denials from the failures:
+// it's true, nil if the request is allowed, false, nil if it's denied, and false with
+// the error if the warden couldn't decide.
+func Decide(ctx context.Context, warden Warden, request *ladon.Request) (bool, error) {
+	err := warden.IsAllowed(ctx, request)
+	switch {
+	case err == nil:
+		return true, nil
+	case IsDenied(err):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// errNilRequest is returned by the wardens instead of a decision on a nil request
+var errNilRequest = errors.New("the request is nil")
+
+// denied returns the ErrDenied describing the request, or an error if there's no request
+func denied(request *ladon.Request) error {
+	if request == nil {
+		return errNilRequest
+	}
+	return &ErrDenied{Subject: request.Subject, Resource: request.Resource, Action: request.Action}
+}
+
+// unavailable wraps err in an ErrUnavailable
+func unavailable(err error) error {
+	return &ErrUnavailable{Err: err}
+}
+
+// failure wraps the error of a call to hydra in an ErrUnavailable if it's a network error
+// or a 5xx or 429 answer, of the api or of the token endpoint. The other errors are returned
+// with the message.
+func failure(err error, message string) error {
+	if transient(err) {
+		return unavailable(err)
+	}
+	return errors.Wrap(err, message)
+}
+
+// transient tells if err is a network error, or a 5xx or 429 answer
+func transient(err error) bool {
+	code := 0
+	cause := errors.Cause(err)
+	if e, ok := cause.(*url.Error); ok {
+		// The errors of the token endpoint are returned by the client inside an url.Error
+		if retrieve, ok := errors.Cause(e.Err).(*oauth2.RetrieveError); ok {
+			cause = retrieve
+		}
+	}
+	switch e := cause.(type) {
+	case *common.APIError:
+		code = e.StatusCode
+	case *oauth2.RetrieveError:
+		if e.Response == nil {
+			return false
+		}
+		code = e.Response.StatusCode
+	case net.Error:
+		return true
+	default:
+		return false
+	}
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
@@ -0,0 +1,152 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+func TestDeniedAndUnavailable(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := authorizer.NewLocalWithOptions(server.URL, 0, common.WithClientCredentials("admin", "demo-password", "hydra"), common.Lazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &ladon.Request{Subject: "me", Action: "eat", Resource: "cake"}
+
+	err = warden.IsAllowed(ctx, request)
+	denied, ok := err.(*authorizer.ErrDenied)
+	if !ok {
+		t.Fatalf("Expected an ErrDenied, got %v", err)
+	}
+	if denied.Subject != "me" || denied.Action != "eat" || denied.Resource != "cake" {
+		t.Errorf("Unexpected denial %+v", denied)
+	}
+	if !authorizer.IsDenied(err) || authorizer.IsUnavailable(err) || errors.Cause(err) != authorizer.ErrNotAllowed {
+		t.Errorf("Expected a denial, got %v", err)
+	}
+	if allowed, err := warden.Decide(ctx, request); allowed || err != nil {
+		t.Errorf("Expected a denial without error, got %v %v", allowed, err)
+	}
+
+	// Without hydra the wardens can't decide
+	server.Close()
+
+	for _, w := range []authorizer.Warden{warden, local} {
+		err := w.IsAllowed(ctx, request)
+		if !authorizer.IsUnavailable(err) || authorizer.IsDenied(err) {
+			t.Errorf("%T: Expected an ErrUnavailable, got %v", w, err)
+		}
+		if allowed, err := authorizer.Decide(ctx, w, request); allowed || err == nil {
+			t.Errorf("%T: Expected an error, got %v %v", w, allowed, err)
+		}
+	}
+
+	mw := authorizer.Middleware{
+		Warden:   warden,
+		Subject:  func(r *http.Request) (string, error) { return "me", nil },
+		Resource: func(r *http.Request) (string, error) { return "cake", nil },
+		Action:   func(r *http.Request) (string, error) { return "eat", nil },
+	}
+	rec := httptest.NewRecorder()
+	mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rec, httptest.NewRequest("GET", "/cake", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without hydra, got %d", rec.Code)
+	}
+}
+
+func TestRejectedAndFailed(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &ladon.Request{Subject: "me", Action: "eat", Resource: "cake"}
+
+	// The 5xx and 429 answers may go away
+	for _, code := range []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusTooManyRequests} {
+		server.Fail("/warden/allowed", code)
+		if err := warden.IsAllowed(ctx, request); !authorizer.IsUnavailable(err) {
+			t.Errorf("Expected an ErrUnavailable for %d, got %v", code, err)
+		}
+	}
+
+	// The 4xx answers don't
+	server.Fail("/warden/allowed", http.StatusBadRequest)
+	err = warden.IsAllowed(ctx, request)
+	if err == nil || authorizer.IsUnavailable(err) || authorizer.IsDenied(err) {
+		t.Errorf("Expected a plain error for a bad request, got %v", err)
+	}
+	if !common.HasStatusCode(err, http.StatusBadRequest) {
+		t.Errorf("Expected the cause to be the bad request, got %v", err)
+	}
+	server.Fail("/warden/allowed", 0)
+
+	// Neither do wrong credentials
+	wrong, err := authorizer.NewAuthorizerWithOptions(server.URL, common.WithClientCredentials("admin", "wrong-password", "hydra"), common.Lazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wrong.IsAllowed(ctx, request); err == nil || authorizer.IsUnavailable(err) || authorizer.IsDenied(err) {
+		t.Errorf("Expected a plain error for wrong credentials, got %v", err)
+	}
+
+	// The same goes for the snapshot of the local authorizer
+	server.Fail("/policies", http.StatusBadGateway)
+	local, err := authorizer.NewLocalWithOptions(server.URL, 0, common.WithClientCredentials("admin", "demo-password", "hydra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.IsAllowed(ctx, request); !authorizer.IsUnavailable(err) {
+		t.Errorf("Expected an ErrUnavailable without the policies, got %v", err)
+	}
+	server.Fail("/policies", http.StatusForbidden)
+	if err := local.IsAllowed(ctx, request); err == nil || authorizer.IsUnavailable(err) || authorizer.IsDenied(err) {
+		t.Errorf("Expected a plain error when the policies are forbidden, got %v", err)
+	}
+}
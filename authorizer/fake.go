@@ -0,0 +1,94 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"sync"
+
+	"github.com/ory/ladon"
+	"golang.org/x/net/context"
+)
+
+// AllowAll is a Warden that allows every request
+type AllowAll struct{}
+
+// IsAllowed always returns nil
+func (AllowAll) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	return nil
+}
+
+// DenyAll is a Warden that denies every request
+type DenyAll struct{}
+
+// IsAllowed always returns an ErrDenied
+func (DenyAll) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	return denied(request)
+}
+
+// Recorder is a Warden that remembers the requests it receives, so that the tests can check
+// which permissions the code asked for. The decisions are delegated to Warden.
+//
+//	recorder := &authorizer.Recorder{Warden: authorizer.AllowAll{}}
+type Recorder struct {
+	// Warden decides on the requests. If nil every request is allowed.
+	Warden Warden
+
+	mu       sync.Mutex
+	requests []*ladon.Request
+}
+
+// IsAllowed records the request and returns the decision of the wrapped Warden
+func (r *Recorder) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	r.mu.Lock()
+	r.requests = append(r.requests, request)
+	r.mu.Unlock()
+
+	if r.Warden == nil {
+		return nil
+	}
+	return r.Warden.IsAllowed(ctx, request)
+}
+
+// Requests returns the requests received so far, in order
+func (r *Recorder) Requests() []*ladon.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	requests := make([]*ladon.Request, len(r.requests))
+	copy(requests, r.requests)
+	return requests
+}
+
+// Reset forgets the recorded requests
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = nil
+}
@@ -0,0 +1,100 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/ory/ladon"
+)
+
+func TestFakes(t *testing.T) {
+	ctx := context.Background()
+
+	recorder := &authorizer.Recorder{}
+	mw := authorizer.Middleware{
+		Warden:   recorder,
+		Subject:  func(r *http.Request) (string, error) { return "me", nil },
+		Resource: authorizer.ResourceFromPath("/items/{id}", "rn:api:items:{id}"),
+		Action:   authorizer.ActionFromMethod(authorizer.DefaultActions),
+	}
+	handler := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	cases := []struct {
+		warden authorizer.Warden
+		code   int
+	}{
+		{nil, http.StatusOK},
+		{authorizer.AllowAll{}, http.StatusOK},
+		{authorizer.DenyAll{}, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		recorder.Warden = tc.warden
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("DELETE", "/items/42", nil))
+		if rec.Code != tc.code {
+			t.Errorf("Expected %d with %T, got %d", tc.code, tc.warden, rec.Code)
+		}
+	}
+
+	requests := recorder.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("Expected 3 recorded requests, got %d", len(requests))
+	}
+	if r := requests[0]; r.Subject != "me" || r.Resource != "rn:api:items:42" || r.Action != "delete" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+
+	// The implementations can be stacked, like a cache in front of the fake
+	recorder.Reset()
+	recorder.Warden = authorizer.DenyAll{}
+	cached := authorizer.NewCachedAuthorizer(recorder, 10, time.Minute, time.Minute)
+	request := &ladon.Request{Subject: "me", Action: "eat", Resource: "cake"}
+	for i := 0; i < 3; i++ {
+		if err := cached.IsAllowed(ctx, request); !authorizer.IsDenied(err) {
+			t.Errorf("Expected a denial, got %v", err)
+		}
+	}
+	if len(recorder.Requests()) != 1 {
+		t.Errorf("Expected the cache to hide the repeated requests, got %d", len(recorder.Requests()))
+	}
+
+	// A nil request is an error, not a denial
+	for _, warden := range []authorizer.Warden{authorizer.DenyAll{}, recorder, cached} {
+		if err := warden.IsAllowed(ctx, nil); err == nil || authorizer.IsDenied(err) {
+			t.Errorf("Expected an error for a nil request with %T, got %v", warden, err)
+		}
+	}
+}
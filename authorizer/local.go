@@ -0,0 +1,212 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Local answers the requests without asking hydra every time: it evaluates them against
+// a Snapshot of the policies and the groups of hydra.
+//
+// The snapshot is taken at the first request, or by Sync, and kept up to date by Start.
+type Local struct {
+	Policies *policies.Manager
+	Groups   *groups.Manager
+	// SyncInterval is how often Start takes a new snapshot
+	SyncInterval time.Duration
+	// SyncTimeout bounds the first sync, which is shared by the requests waiting for it
+	// and doesn't follow the deadline of any of them. Zero means 30 seconds.
+	SyncTimeout time.Duration
+
+	mu       sync.RWMutex
+	snapshot *Snapshot
+	synced   time.Time
+	stop     chan struct{}
+
+	first common.Flight
+}
+
+// NewLocal returns a Local authorizer that takes the snapshots with the given managers
+func NewLocal(policies *policies.Manager, groups *groups.Manager, interval time.Duration) *Local {
+	return &Local{
+		Policies:     policies,
+		Groups:       groups,
+		SyncInterval: interval,
+	}
+}
+
+// NewLocalWithOptions returns a Local authorizer connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewLocalWithOptions(cluster string, interval time.Duration, opts ...common.Option) (*Local, error) {
+	_, client, err := common.Connect(cluster, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Instantiate Local")
+	}
+
+	// The managers share the authenticated client
+	shared := common.WithHTTPClient(client)
+	policyManager, err := policies.NewManagerWithOptions(cluster, shared)
+	if err != nil {
+		return nil, errors.Wrap(err, "Instantiate Local")
+	}
+	groupManager, err := groups.NewManagerWithOptions(cluster, shared)
+	if err != nil {
+		return nil, errors.Wrap(err, "Instantiate Local")
+	}
+	return NewLocal(policyManager, groupManager, interval), nil
+}
+
+// Sync takes a new snapshot of the policies and the groups. If it fails the previous
+// snapshot is kept.
+func (l *Local) Sync() error {
+	return l.SyncCtx(context.Background())
+}
+
+// SyncCtx is like Sync, but the requests are bound to the given context
+func (l *Local) SyncCtx(ctx context.Context) error {
+	all, err := l.Policies.GetAllCtx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Sync policies")
+	}
+
+	ids, err := l.Groups.ListCtx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Sync groups")
+	}
+	list := make([]groups.Group, 0, len(ids))
+	for _, id := range ids {
+		group, err := l.Groups.GetCtx(ctx, id)
+		if common.IsNotFound(err) {
+			// Deleted after the list
+			continue
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Sync group %s", id)
+		}
+		list = append(list, *group)
+	}
+
+	snapshot, err := NewSnapshot(all, list)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.snapshot = snapshot
+	l.synced = time.Now()
+	return nil
+}
+
+// Synced returns when the current snapshot was taken. It's zero if there's none yet.
+func (l *Local) Synced() time.Time {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.synced
+}
+
+// Start takes a new snapshot every SyncInterval in the background, until Stop is called.
+// It does nothing if SyncInterval is zero or if it's already started.
+func (l *Local) Start() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.SyncInterval <= 0 || l.stop != nil {
+		return
+	}
+	l.stop = make(chan struct{})
+
+	go func(stop chan struct{}, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				// On failure the previous snapshot is kept, and the next tick tries again
+				l.Sync()
+			}
+		}
+	}(l.stop, l.SyncInterval)
+}
+
+// Stop ends the background sync started by Start
+func (l *Local) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+}
+
+// IsAllowed evaluates the request against the snapshot, waiting for the first one if there's
+// none yet. It returns an ErrDenied if the subject doesn't have the permission, and an
+// ErrUnavailable if hydra couldn't answer while taking the snapshot.
+func (l *Local) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	if request == nil {
+		return errNilRequest
+	}
+	if l.Synced().IsZero() {
+		if err := l.firstSync(ctx); err != nil {
+			return failure(err, "take the first snapshot")
+		}
+	}
+
+	l.mu.RLock()
+	snapshot := l.snapshot
+	l.mu.RUnlock()
+
+	return snapshot.IsAllowed(ctx, request)
+}
+
+// firstSync takes the first snapshot, merging the concurrent requests into a single sync
+func (l *Local) firstSync(ctx context.Context) error {
+	_, err := l.first.Do(ctx, "sync", l.SyncTimeout, func(ctx context.Context) (interface{}, error) {
+		if !l.Synced().IsZero() {
+			// Taken by the sync that just ended
+			return nil, nil
+		}
+		return nil, l.SyncCtx(ctx)
+	})
+	return err
+}
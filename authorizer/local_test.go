@@ -0,0 +1,214 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	groupManager, err := groups.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyManager.Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"me", "hungry"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana", "cake", "fruit:<.*>"},
+	})
+	policyManager.Create(&policies.Policy{
+		ID:        "diet",
+		Subjects:  []string{"my-friend"},
+		Effect:    "deny",
+		Actions:   []string{"eat"},
+		Resources: []string{"cake"},
+	})
+	policyManager.Create(&policies.Policy{
+		ID:        "owner",
+		Subjects:  []string{"<.*>"},
+		Effect:    "allow",
+		Actions:   []string{"cook"},
+		Resources: []string{"kitchen"},
+		Conditions: map[string]interface{}{
+			"owner": map[string]interface{}{
+				"type":    "EqualsSubjectCondition",
+				"options": map[string]interface{}{},
+			},
+		},
+	})
+	groupManager.Create(&groups.Group{
+		ID:      "hungry",
+		Members: []string{"my-friend"},
+	})
+
+	local, err := authorizer.NewLocalWithOptions(server.URL, 0, common.WithClientCredentials("admin", "demo-password", "hydra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		request *ladon.Request
+		allowed bool
+	}{
+		{&ladon.Request{Subject: "me", Action: "eat", Resource: "banana"}, true},
+		{&ladon.Request{Subject: "me", Action: "eat", Resource: "fruit:apple"}, true},
+		{&ladon.Request{Subject: "me", Action: "eat", Resource: "apple"}, false},
+		{&ladon.Request{Subject: "stranger", Action: "eat", Resource: "banana"}, false},
+		{&ladon.Request{Subject: "my-friend", Action: "eat", Resource: "banana"}, true},
+		{&ladon.Request{Subject: "my-friend", Action: "eat", Resource: "cake"}, false},
+		{&ladon.Request{Subject: "me", Action: "cook", Resource: "kitchen", Context: ladon.Context{"owner": "me"}}, true},
+		{&ladon.Request{Subject: "me", Action: "cook", Resource: "kitchen", Context: ladon.Context{"owner": "you"}}, false},
+	}
+
+	// The local decisions must be the same of hydra's warden
+	for _, tc := range cases {
+		r := tc.request
+		if allowed, err := authorizer.Decide(ctx, remote, r); allowed != tc.allowed || err != nil {
+			t.Errorf("Expected %v from hydra for %s %s %s, got %v %v", tc.allowed, r.Subject, r.Action, r.Resource, allowed, err)
+		}
+		if allowed, err := authorizer.Decide(ctx, local, r); allowed != tc.allowed || err != nil {
+			t.Errorf("Expected %v for %s %s %s, got %v %v", tc.allowed, r.Subject, r.Action, r.Resource, allowed, err)
+		}
+	}
+	if local.Synced().IsZero() {
+		t.Error("Expected the first request to take a snapshot")
+	}
+
+	calls := server.Calls("/warden/allowed")
+	local.IsAllowed(ctx, cases[0].request)
+	if server.Calls("/warden/allowed") != calls {
+		t.Error("Expected the local authorizer not to call the warden")
+	}
+
+	// The changes are visible only after a sync
+	stranger := &ladon.Request{Subject: "stranger", Action: "eat", Resource: "banana"}
+	groupManager.AddMembers("hungry", []string{"stranger"})
+	if err := local.IsAllowed(ctx, stranger); !authorizer.IsDenied(err) {
+		t.Errorf("Expected a denial before the sync, got %v", err)
+	}
+	if err := local.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.IsAllowed(ctx, stranger); err != nil {
+		t.Errorf("Expected to be allowed after the sync, got %s", err)
+	}
+
+	// Start keeps the snapshot up to date
+	local.SyncInterval = 10 * time.Millisecond
+	local.Start()
+	defer local.Stop()
+
+	policyManager.Delete("eat")
+	time.Sleep(50 * time.Millisecond)
+	if err := local.IsAllowed(ctx, stranger); !authorizer.IsDenied(err) {
+		t.Errorf("Expected a denial after the background sync, got %v", err)
+	}
+}
+
+func TestLocalFirstSync(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyManager.Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"me"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana"},
+	})
+
+	local, err := authorizer.NewLocalWithOptions(server.URL, 0, common.WithClientCredentials("admin", "demo-password", "hydra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The requests arriving before the first snapshot share a single sync
+	calls := server.Calls("/policies")
+	request := &ladon.Request{Subject: "me", Action: "eat", Resource: "banana"}
+	start := make(chan struct{})
+	errs := make(chan error, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs <- local.IsAllowed(context.Background(), request)
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if synced := server.Calls("/policies") - calls; synced != 1 {
+		t.Errorf("Expected a single sync, got %d", synced)
+	}
+	if calls := server.Calls("/warden/groups"); calls != 1 {
+		t.Errorf("Expected the groups to be listed once, got %d", calls)
+	}
+
+	if err := local.IsAllowed(context.Background(), nil); err == nil || authorizer.IsDenied(err) {
+		t.Errorf("Expected an error for a nil request, got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/ory/ladon"
+	"github.com/pkg/errors"
+)
+
+// Extractor derives a part of the ladon request from the http request
+type Extractor func(r *http.Request) (string, error)
+
+// Middleware authorizes the incoming requests with a warden, building the ladon request
+// from the http request with the extractors.
+//
+//	mw := authorizer.Middleware{
+//		Warden:   warden,
+//		Subject:  authorizer.SubjectFromToken,
+//		Resource: authorizer.ResourceFromPath("/items/{id}", "rn:api:items:{id}"),
+//		Action:   authorizer.ActionFromMethod(authorizer.DefaultActions),
+//	}
+//	http.Handle("/items/", tokens.Handler(mw.Handler(items)))
+type Middleware struct {
+	// Warden decides on the requests, with the context of the http request. It's required.
+	Warden Warden
+
+	// Subject defaults to SubjectFromToken
+	Subject Extractor
+	// Resource is required
+	Resource Extractor
+	// Action defaults to ActionFromMethod(DefaultActions)
+	Action Extractor
+	// Context is optional, and fills the context of the ladon request
+	Context func(r *http.Request) ladon.Context
+}
+
+// DefaultActions maps the http methods to the usual crud actions
+var DefaultActions = map[string]string{
+	"GET":    "get",
+	"HEAD":   "get",
+	"POST":   "create",
+	"PUT":    "update",
+	"PATCH":  "update",
+	"DELETE": "delete",
+}
+
+// Handler returns a handler that calls next only if the warden allows the request.
+// It answers with 401 and a Bearer challenge if the subject can't be extracted, 403 if the request is denied,
+// and 503 if the warden fails to decide.
+// It panics if the Warden or the Resource extractor are missing.
+func (m Middleware) Handler(next http.Handler) http.Handler {
+	if m.Warden == nil {
+		panic("authorizer: Middleware without a Warden")
+	}
+	if m.Resource == nil {
+		panic("authorizer: Middleware without a Resource extractor")
+	}
+	if m.Subject == nil {
+		m.Subject = SubjectFromToken
+	}
+	if m.Action == nil {
+		m.Action = ActionFromMethod(DefaultActions)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, err := m.Subject(r)
+		if err != nil {
+			// The token didn't identify the caller: ask for one that does, as introspect.Middleware
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, "request_unauthorized", err.Error(), nil)
+			return
+		}
+		resource, err := m.Resource(r)
+		if err != nil {
+			writeError(w, http.StatusForbidden, "request_forbidden", err.Error(), nil)
+			return
+		}
+		action, err := m.Action(r)
+		if err != nil {
+			writeError(w, http.StatusForbidden, "request_forbidden", err.Error(), nil)
+			return
+		}
+
+		request := &ladon.Request{Subject: subject, Resource: resource, Action: action}
+		if m.Context != nil {
+			request.Context = m.Context(r)
+		}
+
+		// Fail closed: anything that is not a decision is a failure
+		switch err := m.Warden.IsAllowed(r.Context(), request); {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case IsDenied(err):
+			writeError(w, http.StatusForbidden, "request_forbidden", "The request is not allowed", request)
+		default:
+			writeError(w, http.StatusServiceUnavailable, "service_unavailable", "The request could not be authorized", nil)
+		}
+	})
+}
+
+// SubjectFromToken returns the subject of the token validated by introspect.Middleware
+func SubjectFromToken(r *http.Request) (string, error) {
+	i, ok := introspect.FromContext(r.Context())
+	if !ok || i.Subject == "" {
+		return "", errors.New("the request has no authenticated subject")
+	}
+	return i.Subject, nil
+}
+
+// ActionFromMethod returns an Extractor that maps the method of the request to an action
+func ActionFromMethod(actions map[string]string) Extractor {
+	return func(r *http.Request) (string, error) {
+		action, ok := actions[r.Method]
+		if !ok {
+			return "", errors.Errorf("no action for the method %s", r.Method)
+		}
+		return action, nil
+	}
+}
+
+// ResourceFromTemplate returns an Extractor that fills the {name} placeholders of the template
+// with the values returned by param, typically the path parameters of a router
+func ResourceFromTemplate(template string, param func(r *http.Request, name string) string) Extractor {
+	return func(r *http.Request) (string, error) {
+		return fill(template, func(name string) string { return param(r, name) }), nil
+	}
+}
+
+// ResourceFromPath returns an Extractor that matches the path of the request against the
+// pattern, where every {name} matches a single segment, and fills the template with them.
+// For example the pattern /items/{id} and the template rn:api:items:{id} turn /items/42
+// into rn:api:items:42.
+func ResourceFromPath(pattern, template string) Extractor {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+
+	return func(r *http.Request) (string, error) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != len(patternParts) {
+			return "", errors.Errorf("the path %s doesn't match %s", r.URL.Path, pattern)
+		}
+
+		params := map[string]string{}
+		for i, p := range patternParts {
+			if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+				params[p[1:len(p)-1]] = parts[i]
+			} else if p != parts[i] {
+				return "", errors.Errorf("the path %s doesn't match %s", r.URL.Path, pattern)
+			}
+		}
+		return fill(template, func(name string) string { return params[name] }), nil
+	}
+}
+
+// fill replaces the {name} placeholders of the template
+func fill(template string, value func(name string) string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "}")
+		if start < 0 || end < start {
+			b.WriteString(template)
+			return b.String()
+		}
+		b.WriteString(template[:start])
+		b.WriteString(value(template[start+1 : end]))
+		template = template[end+1:]
+	}
+}
+
+// writeError writes a json error, with the details of the denied request if present
+func writeError(w http.ResponseWriter, code int, name, description string, request *ladon.Request) {
+	body := map[string]interface{}{
+		"error":             name,
+		"error_description": description,
+		"status_code":       code,
+	}
+	if request != nil {
+		body["subject"] = request.Subject
+		body["resource"] = request.Resource
+		body["action"] = request.Action
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
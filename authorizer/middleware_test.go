@@ -0,0 +1,165 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/codeclysm/introspector/v3"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyManager.Create(&policies.Policy{
+		ID:        "read items",
+		Subjects:  []string{"me"},
+		Effect:    "allow",
+		Actions:   []string{"get"},
+		Resources: []string{"rn:api:items:<.*>"},
+	})
+
+	warden, err := authorizer.NewAuthorizer("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := introspect.NewIntrospector("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw := authorizer.Middleware{
+		Warden:   warden,
+		Subject:  authorizer.SubjectFromToken,
+		Resource: authorizer.ResourceFromPath("/items/{id}", "rn:api:items:{id}"),
+		Action:   authorizer.ActionFromMethod(authorizer.DefaultActions),
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := introspect.Middleware{Introspector: tokens}.Handler(mw.Handler(ok))
+
+	cases := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/items/42", 200},
+		{"DELETE", "/items/42", 403},
+		{"GET", "/items/42/comments", 403},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code {
+			t.Errorf("Expected %d for %s %s, got %d: %s", tc.code, tc.method, tc.path, rec.Code, rec.Body)
+		}
+	}
+
+	// The denied requests are described in the body
+	req := httptest.NewRequest("DELETE", "/items/42", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var body map[string]interface{}
+	json.NewDecoder(rec.Body).Decode(&body)
+	if body["subject"] != "me" || body["resource"] != "rn:api:items:42" || body["action"] != "delete" {
+		t.Errorf("Unexpected body %v", body)
+	}
+
+	// Without the introspect middleware there's no subject
+	rec = httptest.NewRecorder()
+	mw.Handler(ok).ServeHTTP(rec, httptest.NewRequest("GET", "/items/42", nil))
+	if rec.Code != 401 {
+		t.Errorf("Expected 401 without a subject, got %d", rec.Code)
+	}
+	if challenge := rec.Header().Get("WWW-Authenticate"); challenge != `Bearer error="invalid_token"` {
+		t.Errorf("Expected a Bearer challenge without a subject, got '%s'", challenge)
+	}
+}
+
+func TestMiddlewareDefaults(t *testing.T) {
+	recorder := &authorizer.Recorder{}
+	mw := authorizer.Middleware{
+		Warden:   recorder,
+		Resource: authorizer.ResourceFromPath("/items/{id}", "rn:api:items:{id}"),
+	}
+	handler := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	req = req.WithContext(introspect.NewContext(req.Context(), introspector.Introspection{Active: true, Subject: "me"}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rec.Code)
+	}
+
+	requests := recorder.Requests()
+	if len(requests) != 1 || requests[0].Subject != "me" || requests[0].Action != "get" {
+		t.Errorf("Expected the subject of the token and the action of the method, got %+v", requests)
+	}
+
+	// The required parts are checked when the handler is built
+	for name, incomplete := range map[string]authorizer.Middleware{
+		"warden":   {Resource: mw.Resource},
+		"resource": {Warden: recorder},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected a panic without the %s", name)
+				}
+			}()
+			incomplete.Handler(http.NotFoundHandler())
+		}()
+	}
+}
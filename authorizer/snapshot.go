@@ -0,0 +1,122 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package authorizer
+
+import (
+	"encoding/json"
+
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+	"github.com/ory/ladon/manager/memory"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Snapshot evaluates the requests against a fixed set of policies and groups, with the semantics
+// of hydra's warden: the request is evaluated for the subject and for each of its groups,
+// a policy that forcefully denies any of them wins, otherwise a single allow is enough.
+type Snapshot struct {
+	warden  *ladon.Ladon
+	members map[string][]string
+}
+
+// NewSnapshot loads the policies and the groups in a Snapshot.
+// It fails if a policy can't be converted to a ladon one.
+func NewSnapshot(policyList []policies.Policy, groupList []groups.Group) (*Snapshot, error) {
+	manager := memory.NewMemoryManager()
+	for _, p := range policyList {
+		policy, err := toLadon(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := manager.Create(policy); err != nil {
+			return nil, errors.Wrapf(err, "load policy %s", p.ID)
+		}
+	}
+
+	members := map[string][]string{}
+	for _, group := range groupList {
+		for _, member := range group.Members {
+			members[member] = append(members[member], group.ID)
+		}
+	}
+
+	return &Snapshot{
+		// ladon sets the default matcher and logger lazily, which races with concurrent requests
+		warden:  &ladon.Ladon{Manager: manager, Matcher: ladon.DefaultMatcher, AuditLogger: ladon.DefaultAuditLogger},
+		members: members,
+	}, nil
+}
+
+// IsAllowed evaluates the request. It returns an ErrDenied if the subject doesn't have the permission.
+func (s *Snapshot) IsAllowed(ctx context.Context, request *ladon.Request) error {
+	if request == nil {
+		return errNilRequest
+	}
+
+	allowed := false
+	subjects := append([]string{request.Subject}, s.members[request.Subject]...)
+	for _, subject := range subjects {
+		err := s.warden.IsAllowed(&ladon.Request{
+			Subject:  subject,
+			Resource: request.Resource,
+			Action:   request.Action,
+			Context:  request.Context,
+		})
+		switch errors.Cause(err) {
+		case nil:
+			allowed = true
+		case ladon.ErrRequestForcefullyDenied:
+			return denied(request)
+		case ladon.ErrRequestDenied:
+		default:
+			return errors.Wrapf(err, "evaluate request for %s", subject)
+		}
+	}
+
+	if !allowed {
+		return denied(request)
+	}
+	return nil
+}
+
+// toLadon converts the policy to the one used by ladon, whose conditions have the same json format
+func toLadon(p policies.Policy) (*ladon.DefaultPolicy, error) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return nil, errors.Wrapf(err, "json marshal of %v", p)
+	}
+	var policy ladon.DefaultPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, errors.Wrapf(err, "json unmarshal of %s", data)
+	}
+	return &policy, nil
+}
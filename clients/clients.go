@@ -38,6 +38,7 @@ import (
 
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 // Client is an oauth2 client saved on hydra database
@@ -65,27 +66,45 @@ type ClientGetter interface {
 
 // Manager uses hydra rest apis to retrieve clients
 type Manager struct {
-	Endpoint *url.URL
-	Client   *http.Client
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	Client         *http.Client
 }
 
 // NewManager returns a Manager connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewManager(id, secret, cluster string) (*Manager, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewManagerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewManagerWithOptions returns a Manager connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewManagerWithOptions(cluster string, opts ...common.Option) (*Manager, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate Manager")
 	}
 
 	manager := Manager{
-		Endpoint: common.JoinURL(endpoint, "clients"),
-		Client:   client,
+		Endpoint:       common.JoinURL(endpoint, "clients"),
+		HealthEndpoint: common.JoinURL(endpoint, "health", "status"),
+		Client:         client,
 	}
 	return &manager, nil
 }
 
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Manager) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
 // Create queries the hydra api to create a new client
 func (m Manager) Create(client *Client) error {
+	return m.CreateCtx(context.Background(), client)
+}
+
+// CreateCtx is like Create, but the request is bound to the given context
+func (m Manager) CreateCtx(ctx context.Context, client *Client) error {
 	url := m.Endpoint.String()
 
 	payload, err := json.Marshal(*client)
@@ -97,6 +116,7 @@ func (m Manager) Create(client *Client) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, client)
 	if err != nil {
@@ -108,12 +128,18 @@ func (m Manager) Create(client *Client) error {
 
 // Delete queries the hydra api to retrieve a specific client by their ID.
 func (m Manager) Delete(id string) error {
+	return m.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but the request is bound to the given context
+func (m Manager) DeleteCtx(ctx context.Context, id string) error {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -124,28 +150,40 @@ func (m Manager) Delete(id string) error {
 
 // Get queries the hydra api to retrieve a specific client by their ID.
 func (m Manager) Get(id string) (*Client, error) {
+	return m.GetCtx(context.Background(), id)
+}
+
+// GetCtx is like Get, but the request is bound to the given context
+func (m Manager) GetCtx(ctx context.Context, id string) (*Client, error) {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
-	var client *Client
+	var client Client
 
-	err = common.Bind(m.Client, req, client)
+	err = common.Bind(m.Client, req, &client)
 	if err != nil {
 		return nil, err
 	}
-	return client, nil
+	return &client, nil
 }
 
 // GetAll calls the hydra api to return all the clients
 func (m *Manager) GetAll() (map[string]Client, error) {
+	return m.GetAllCtx(context.Background())
+}
+
+// GetAllCtx is like GetAll, but the request is bound to the given context
+func (m *Manager) GetAllCtx(ctx context.Context) (map[string]Client, error) {
 	req, err := http.NewRequest("GET", m.Endpoint.String(), nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", m.Endpoint.String())
 	}
+	req = req.WithContext(ctx)
 
 	var clients map[string]Client
 
@@ -158,6 +196,11 @@ func (m *Manager) GetAll() (map[string]Client, error) {
 
 // Update calls the hydra api to update a specific client
 func (m *Manager) Update(id string, client *Client) error {
+	return m.UpdateCtx(context.Background(), id, client)
+}
+
+// UpdateCtx is like Update, but the request is bound to the given context
+func (m *Manager) UpdateCtx(ctx context.Context, id string, client *Client) error {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	payload, err := json.Marshal(client)
@@ -169,6 +212,7 @@ func (m *Manager) Update(id string, client *Client) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, client)
 	if err != nil {
@@ -0,0 +1,159 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package clients_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/clients"
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+)
+
+func TestClients(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := clients.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := clients.Client{
+		ID:         "example client",
+		Name:       "example",
+		GrantTypes: []string{"client_credentials"},
+	}
+
+	err = manager.Create(&payload)
+	if err != nil {
+		t.Error(err)
+	}
+	if payload.Secret == "" {
+		t.Error("Expected the secret to be generated")
+	}
+
+	err = manager.Create(&clients.Client{ID: payload.ID})
+	if !common.IsConflict(err) {
+		t.Errorf("Expected a conflict creating the client twice, got %v", err)
+	}
+
+	client, err := manager.Get(payload.ID)
+	if err != nil {
+		t.Error(err)
+	}
+	if client.Name != payload.Name {
+		t.Errorf("Expected Name='%s', got %s", payload.Name, client.Name)
+	}
+
+	client.Name = "renamed"
+	err = manager.Update(payload.ID, client)
+	if err != nil {
+		t.Error(err)
+	}
+
+	list, err := manager.GetAll()
+	if err != nil {
+		t.Error(err)
+	}
+	if list[payload.ID].Name != "renamed" {
+		t.Errorf("Expected Name='renamed', got %s", list[payload.ID].Name)
+	}
+
+	err = manager.Delete(payload.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, err = manager.Get(payload.ID)
+	if !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error retrieving a deleted client, got %v", err)
+	}
+}
+
+func TestWrongCredentials(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	_, err := clients.NewManager("admin", "wrong-password", server.URL)
+	if err == nil {
+		t.Error("Expected an error with the wrong credentials")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	server := hydratest.NewServer()
+	url := server.URL
+	server.Close()
+
+	// The cluster is down, but the manager can be created anyway
+	manager, err := clients.NewManagerWithOptions(url, common.WithClientCredentials("admin", "demo-password", "hydra"), common.Lazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Ping(context.Background()); err == nil {
+		t.Error("Expected Ping to fail with the cluster down")
+	}
+
+	server = hydratest.NewServer()
+	defer server.Close()
+
+	manager, err = clients.NewManagerWithOptions(server.URL, common.WithClientCredentials("admin", "wrong-password", "hydra"), common.Lazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Ping(context.Background()); err == nil {
+		t.Error("Expected Ping to fail with the wrong credentials")
+	}
+
+	before := server.Calls("/oauth2/token")
+	manager, err = clients.NewManagerWithOptions(server.URL, common.WithClientCredentials("admin", "demo-password", "hydra"), common.Lazy())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := server.Calls("/oauth2/token"); calls != before {
+		t.Errorf("Expected no token exchange before the first request, got %d", calls-before)
+	}
+	if err := manager.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if _, err := manager.GetAll(); err != nil {
+		t.Error(err)
+	}
+	if calls := server.Calls("/oauth2/token"); calls != before+1 {
+		t.Errorf("Expected a single token exchange, got %d", calls-before)
+	}
+
+	_, err = clients.NewManagerWithOptions("localhost:4444", common.WithClientCredentials("admin", "demo-password"), common.Lazy())
+	if err == nil {
+		t.Error("Expected an error for a cluster without scheme")
+	}
+}
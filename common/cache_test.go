@@ -0,0 +1,63 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+)
+
+func TestCache(t *testing.T) {
+	cache := common.NewCache(2)
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Get("a")
+	cache.Set("c", 3, time.Minute)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("Expected b to be evicted, since it's the least recently used")
+	}
+	if v, ok := cache.Get("a"); !ok || v.(int) != 1 {
+		t.Errorf("Expected a to be 1, got %v", v)
+	}
+
+	cache.Set("d", 4, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := cache.Get("d"); ok {
+		t.Error("Expected d to be expired")
+	}
+
+	if stats := cache.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Size != 1 {
+		t.Errorf("Expected 2 hits, 2 misses and size 1, got %+v", stats)
+	}
+}
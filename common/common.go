@@ -40,7 +40,6 @@ import (
 	"github.com/pkg/errors"
 
 	"golang.org/x/net/context"
-	"golang.org/x/oauth2/clientcredentials"
 )
 
 // JoinURL creates an url from the given parts
@@ -57,7 +56,8 @@ func CopyURL(u *url.URL) *url.URL {
 	return a
 }
 
-// Bind does a get request and binds the body to the given interface
+// Bind does a get request and binds the body to the given interface.
+// If the response has an unexpected status code the error is an *APIError.
 func Bind(client *http.Client, req *http.Request, o interface{}) error {
 	resp, err := client.Do(req)
 	if err != nil {
@@ -71,7 +71,7 @@ func Bind(client *http.Client, req *http.Request, o interface{}) error {
 		return nil
 	}
 	if resp.StatusCode > 299 {
-		return errors.Errorf("Expected status code %d, got %d.\n%s\n", http.StatusOK, resp.StatusCode, body)
+		return newAPIError(resp.StatusCode, body)
 	} else if err := json.NewDecoder(bytes.NewBuffer(body)).Decode(o); err != nil {
 		return errors.Wrapf(err, "decode json %s", body)
 	}
@@ -80,21 +80,34 @@ func Bind(client *http.Client, req *http.Request, o interface{}) error {
 
 // Authenticate returns the url of the cluster and an authenticated Client
 func Authenticate(id, secret, cluster string, scopes ...string) (*url.URL, *http.Client, error) {
-	uri, err := url.Parse(cluster)
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "parse url %s", cluster)
+	return AuthenticateCtx(context.Background(), id, secret, cluster, scopes...)
+}
+
+// AuthenticateCtx is like Authenticate, but the initial token exchange is bound to the given context.
+// The returned Client refreshes its token independently from ctx, so it can outlive it.
+func AuthenticateCtx(ctx context.Context, id, secret, cluster string, scopes ...string) (*url.URL, *http.Client, error) {
+	return ConnectCtx(ctx, cluster, WithClientCredentials(id, secret, scopes...))
+}
+
+// Ping checks that the cluster is reachable and healthy. Since the request is performed by
+// the authenticated client, it also retrieves a token if the client doesn't have one yet.
+func Ping(ctx context.Context, client *http.Client, health *url.URL) error {
+	if health == nil {
+		return errors.New("no health endpoint configured")
 	}
-	credentials := clientcredentials.Config{
-		ClientID:     id,
-		ClientSecret: secret,
-		TokenURL:     JoinURL(uri, "oauth2/token").String(),
-		Scopes:       scopes,
+
+	req, err := http.NewRequest("GET", health.String(), nil)
+	if err != nil {
+		return errors.Wrapf(err, "new request for %s", health)
 	}
+	req = req.WithContext(ctx)
 
-	ctx := context.Background()
-	_, err = credentials.Token(ctx)
+	var status struct {
+		Status string `json:"status"`
+	}
+	err = Bind(client, req, &status)
 	if err != nil {
-		return nil, nil, errors.Wrapf(err, "connect to cluster %s", cluster)
+		return errors.Wrap(err, "Ping")
 	}
-	return uri, credentials.Client(ctx), nil
+	return nil
 }
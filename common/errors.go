@@ -0,0 +1,131 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// APIError is returned by Bind when hydra answers with an unexpected status code.
+// It carries the fields of the hydra error payload, when present, and the raw body.
+type APIError struct {
+	StatusCode  int
+	Name        string
+	Description string
+	RequestID   string
+	Body        []byte
+}
+
+// Error returns a description of the error, including the status code
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("Expected status code %d, got %d.", http.StatusOK, e.StatusCode)
+	if e.Name != "" {
+		msg += " " + e.Name
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	if e.Name == "" && e.Description == "" && len(e.Body) > 0 {
+		msg += "\n" + string(e.Body)
+	}
+	return msg
+}
+
+// newAPIError parses the body of an error response. Hydra uses both the flat
+// oauth2 format and the one where the error is an object, so both are accepted.
+func newAPIError(code int, body []byte) *APIError {
+	e := APIError{StatusCode: code, Body: body}
+
+	var payload struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+		RequestID        string          `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return &e
+	}
+	e.Description = payload.ErrorDescription
+	e.RequestID = payload.RequestID
+
+	var nested struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Reason  string `json:"reason"`
+		Request string `json:"request"`
+	}
+	if err := json.Unmarshal(payload.Error, &e.Name); err == nil {
+		return &e
+	}
+	if err := json.Unmarshal(payload.Error, &nested); err == nil {
+		e.Name = nested.Status
+		e.Description = nested.Message
+		if nested.Reason != "" {
+			e.Description += " " + nested.Reason
+		}
+		e.RequestID = nested.Request
+	}
+	return &e
+}
+
+// AsAPIError returns the APIError that caused err, if any
+func AsAPIError(err error) (*APIError, bool) {
+	e, ok := errors.Cause(err).(*APIError)
+	return e, ok
+}
+
+// HasStatusCode returns true if err was caused by a response with the given status code
+func HasStatusCode(err error, code int) bool {
+	e, ok := AsAPIError(err)
+	return ok && e.StatusCode == code
+}
+
+// IsNotFound returns true if err was caused by hydra not finding the resource
+func IsNotFound(err error) bool {
+	return HasStatusCode(err, http.StatusNotFound)
+}
+
+// IsConflict returns true if err was caused by hydra refusing to overwrite a resource
+func IsConflict(err error) bool {
+	return HasStatusCode(err, http.StatusConflict)
+}
+
+// IsUnauthorized returns true if err was caused by missing or invalid credentials
+func IsUnauthorized(err error) bool {
+	return HasStatusCode(err, http.StatusUnauthorized)
+}
+
+// IsForbidden returns true if err was caused by the client lacking the permissions for the request
+func IsForbidden(err error) bool {
+	return HasStatusCode(err, http.StatusForbidden)
+}
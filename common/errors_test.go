@@ -0,0 +1,89 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/pkg/errors"
+)
+
+func TestAPIError(t *testing.T) {
+	cases := []struct {
+		body        string
+		code        int
+		name        string
+		description string
+		requestID   string
+	}{
+		{`{"error":"Not Found","error_description":"Unable to locate the resource","request_id":"1"}`, 404, "Not Found", "Unable to locate the resource", "1"},
+		{`{"error":{"code":409,"status":"Conflict","message":"Already exists","request":"2"}}`, 409, "Conflict", "Already exists", "2"},
+		{`Unauthorized`, 401, "", "", ""},
+	}
+
+	for _, tc := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tc.code)
+			w.Write([]byte(tc.body))
+		}))
+
+		req, _ := http.NewRequest("GET", server.URL, nil)
+		err := common.Bind(http.DefaultClient, req, nil)
+		server.Close()
+
+		e, ok := common.AsAPIError(errors.Wrap(err, "wrapped"))
+		if !ok {
+			t.Errorf("Expected an APIError, got %T", err)
+			continue
+		}
+		if e.StatusCode != tc.code || e.Name != tc.name || e.Description != tc.description || e.RequestID != tc.requestID {
+			t.Errorf("Unexpected APIError %+v for %s", e, tc.body)
+		}
+		if string(e.Body) != tc.body {
+			t.Errorf("Expected Body='%s', got %s", tc.body, e.Body)
+		}
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	err := errors.Wrap(&common.APIError{StatusCode: http.StatusNotFound}, "Get")
+	if !common.IsNotFound(err) {
+		t.Error("Expected IsNotFound to be true")
+	}
+	if common.IsConflict(err) || common.IsUnauthorized(err) {
+		t.Error("Expected IsConflict and IsUnauthorized to be false")
+	}
+	if common.IsNotFound(errors.New("not found")) {
+		t.Error("Expected IsNotFound to be false for a plain error")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/sync/singleflight"
+)
+
+// DefaultFlightTimeout bounds the calls of a Flight when no timeout is given
+const DefaultFlightTimeout = 30 * time.Second
+
+// Flight merges the concurrent calls with the same key into a single one. The call runs on
+// its own context, so a caller giving up doesn't make the others fail: each caller waits for
+// the result, or until its own ctx is done. The zero value is ready to use.
+type Flight struct {
+	group singleflight.Group
+}
+
+// Do calls fn, unless a call with the same key is in progress, and returns its result.
+// fn receives a context bounded by timeout, or by DefaultFlightTimeout if it's zero.
+func (f *Flight) Do(ctx context.Context, key string, timeout time.Duration, fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if timeout <= 0 {
+		timeout = DefaultFlightTimeout
+	}
+
+	results := f.group.DoChan(key, func() (interface{}, error) {
+		callCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return fn(callCtx)
+	})
+
+	select {
+	case result := <-results:
+		return result.Val, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,231 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Option configures how Connect authenticates to the cluster
+type Option func(*options)
+
+type options struct {
+	client *http.Client
+	source func(ctx context.Context, tokenURL string) oauth2.TokenSource
+	retry  *RetryPolicy
+	lazy   bool
+}
+
+// WithClientCredentials authenticates with the client credentials grant, using id and secret
+func WithClientCredentials(id, secret string, scopes ...string) Option {
+	return func(o *options) {
+		o.source = func(ctx context.Context, tokenURL string) oauth2.TokenSource {
+			credentials := clientcredentials.Config{
+				ClientID:     id,
+				ClientSecret: secret,
+				TokenURL:     tokenURL,
+				Scopes:       scopes,
+			}
+			return credentials.TokenSource(ctx)
+		}
+	}
+}
+
+// WithClientAssertion authenticates with the client credentials grant, using a jwt signed with key
+// instead of a secret, as described in https://tools.ietf.org/html/rfc7523#section-2.2.
+// The algorithm and the id of the key are taken from the key itself.
+func WithClientAssertion(id string, key jose.JSONWebKey, scopes ...string) Option {
+	return func(o *options) {
+		o.source = func(ctx context.Context, tokenURL string) oauth2.TokenSource {
+			return &assertionSource{ctx: ctx, id: id, key: key, tokenURL: tokenURL, scopes: scopes}
+		}
+	}
+}
+
+// WithTokenSource authenticates with the tokens returned by source
+func WithTokenSource(source oauth2.TokenSource) Option {
+	return func(o *options) {
+		o.source = func(context.Context, string) oauth2.TokenSource {
+			return source
+		}
+	}
+}
+
+// WithBearerToken authenticates with a static token, which is never refreshed
+func WithBearerToken(token string) Option {
+	return WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token, TokenType: "Bearer"}))
+}
+
+// WithHTTPClient performs the requests, including the ones to retrieve the tokens, with client.
+// If no other option provides the tokens the client is used as is, for example when it's already
+// authenticated with mutual tls or when it goes through an authenticating proxy.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+// WithRetryPolicy retries the failed requests according to the policy
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = &policy
+	}
+}
+
+// Lazy postpones the retrieval of the first token to the first request, so that Connect
+// doesn't fail if the cluster is unreachable. Use Ping to check the connection.
+func Lazy() Option {
+	return func(o *options) {
+		o.lazy = true
+	}
+}
+
+// Connect returns the url of the cluster and a Client authenticated according to the options.
+// If the options provide the tokens it retrieves one, to verify that they work, unless Lazy is used.
+func Connect(cluster string, opts ...Option) (*url.URL, *http.Client, error) {
+	return ConnectCtx(context.Background(), cluster, opts...)
+}
+
+// ConnectCtx is like Connect, but the initial token exchange is bound to the given context.
+// The returned Client refreshes its token independently from ctx, so it can outlive it.
+func ConnectCtx(ctx context.Context, cluster string, opts ...Option) (*url.URL, *http.Client, error) {
+	uri, err := url.Parse(cluster)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "parse url %s", cluster)
+	}
+	if uri.Scheme == "" || uri.Host == "" {
+		return nil, nil, errors.Errorf("parse url %s: missing scheme or host", cluster)
+	}
+
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.source == nil && o.client == nil {
+		return nil, nil, errors.New("no authentication method configured")
+	}
+
+	base := o.client
+	if base == nil {
+		base = http.DefaultClient
+	}
+
+	client := base
+	if o.source != nil {
+		tokenURL := JoinURL(uri, "oauth2/token").String()
+
+		var token *oauth2.Token
+		if !o.lazy {
+			token, err = o.source(context.WithValue(ctx, oauth2.HTTPClient, base), tokenURL).Token()
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "connect to cluster %s", cluster)
+			}
+		}
+
+		source := o.source(context.WithValue(context.Background(), oauth2.HTTPClient, base), tokenURL)
+		client = &http.Client{
+			Transport: &oauth2.Transport{
+				Source: oauth2.ReuseTokenSource(token, source),
+				Base:   base.Transport,
+			},
+			CheckRedirect: base.CheckRedirect,
+			Jar:           base.Jar,
+			Timeout:       base.Timeout,
+		}
+	}
+
+	if o.retry != nil {
+		client = WithRetry(client, *o.retry)
+	}
+	return uri, client, nil
+}
+
+// assertionSource retrieves tokens authenticating with a signed jwt
+type assertionSource struct {
+	ctx      context.Context
+	id       string
+	key      jose.JSONWebKey
+	tokenURL string
+	scopes   []string
+}
+
+// Token signs a new assertion and exchanges it for a token
+func (s *assertionSource) Token() (*oauth2.Token, error) {
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.SignatureAlgorithm(s.key.Algorithm), Key: s.key},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "new signer for key %s", s.key.KeyID)
+	}
+
+	now := time.Now()
+	assertion, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   s.id,
+		Subject:  s.id,
+		Audience: jwt.Audience{s.tokenURL},
+		ID:       randomID(),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	}).CompactSerialize()
+	if err != nil {
+		return nil, errors.Wrap(err, "sign client assertion")
+	}
+
+	credentials := clientcredentials.Config{
+		ClientID: s.id,
+		TokenURL: s.tokenURL,
+		Scopes:   s.scopes,
+		EndpointParams: url.Values{
+			"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+			"client_assertion":      {assertion},
+		},
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return credentials.Token(s.ctx)
+}
+
+// randomID returns a random hex string, suitable for the id of a jwt
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/codeclysm/introspector/v3"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestConnect(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("static-token", introspector.Introspection{
+		Active:    true,
+		Subject:   "job",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk := jose.JSONWebKey{Key: key, KeyID: "assertion", Algorithm: "RS256", Use: "sig"}
+	server.AddAssertionKey("assertion-client", jwk.Public())
+
+	cases := map[string][]common.Option{
+		"client credentials": {common.WithClientCredentials("admin", "demo-password", "hydra")},
+		"bearer token":       {common.WithBearerToken("static-token")},
+		"client assertion":   {common.WithClientAssertion("assertion-client", jwk, "hydra")},
+		"retry policy":       {common.WithClientCredentials("admin", "demo-password"), common.WithRetryPolicy(common.DefaultRetryPolicy)},
+		"http client": {
+			common.WithHTTPClient(&http.Client{Timeout: time.Second}),
+			common.WithClientCredentials("admin", "demo-password"),
+		},
+	}
+
+	for name, opts := range cases {
+		uri, client, err := common.Connect(server.URL, opts...)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		req, _ := http.NewRequest("GET", common.JoinURL(uri, "policies").String(), nil)
+		var list []interface{}
+		if err := common.Bind(client, req, &list); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+func TestConnectFails(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	_, _, err := common.Connect(server.URL)
+	if err == nil {
+		t.Error("Expected an error without authentication")
+	}
+
+	_, _, err = common.Connect(server.URL, common.WithClientCredentials("admin", "wrong-password"))
+	if err == nil {
+		t.Error("Expected an error with the wrong credentials")
+	}
+
+	// A plain http client is used as is, and hydra refuses its requests
+	uri, client, err := common.Connect(server.URL, common.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", common.JoinURL(uri, "policies").String(), nil)
+	err = common.Bind(client, req, nil)
+	if !common.IsUnauthorized(err) {
+		t.Errorf("Expected an unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common
+
+import (
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// RetryPolicy describes how the requests that failed because of a transient error are retried.
+// Network errors and the 429, 502, 503 and 504 status codes are considered transient.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry. It doubles at every attempt,
+	// up to MaxBackoff, and a random jitter is subtracted from it.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// RetryPost enables the retry of POST requests, which are not idempotent
+	RetryPost bool
+}
+
+// DefaultRetryPolicy retries GET, PUT and DELETE requests up to 4 times in about 2 seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  250 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+// WithRetry returns a copy of the client whose requests are retried according to the policy.
+// Every manager exposes its http client, so it can be used like this:
+//
+//	manager.Client = common.WithRetry(manager.Client, common.DefaultRetryPolicy)
+func WithRetry(client *http.Client, policy RetryPolicy) *http.Client {
+	c := *client
+	c.Transport = &RetryTransport{Base: client.Transport, Policy: policy}
+	return &c
+}
+
+// RetryTransport is an http.RoundTripper that retries the requests according to a RetryPolicy.
+// A request with a body is retried only if it has GetBody, like the ones built with http.NewRequest.
+type RetryTransport struct {
+	// Base is the transport used to perform the requests. If nil, http.DefaultTransport is used.
+	Base   http.RoundTripper
+	Policy RetryPolicy
+}
+
+// RoundTrip performs the request, retrying it in case of transient errors
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if !t.retriable(req) {
+		return base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		r := *req
+		if req.Body != nil && attempt > 1 {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+
+		resp, err := base.RoundTrip(&r)
+		if attempt >= t.Policy.MaxAttempts || !transient(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp); ok {
+				if after > t.Policy.MaxBackoff {
+					return resp, err
+				}
+				wait = after
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retriable returns true if the method and the body of the request allow to retry it
+func (t *RetryTransport) retriable(req *http.Request) bool {
+	if t.Policy.MaxAttempts < 2 {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case "", "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	case "POST":
+		return t.Policy.RetryPost
+	}
+	return false
+}
+
+// backoff returns the wait before the given retry, with jitter
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	wait := t.Policy.MinBackoff
+	for i := 1; i < attempt && wait < t.Policy.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > t.Policy.MaxBackoff {
+		wait = t.Policy.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// transient returns true if the request failed for a reason that may go away
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return temporary(err)
+	}
+	return transientStatus(resp.StatusCode)
+}
+
+// temporary returns true for the network errors and the timeouts. The errors of the token
+// endpoint are retried only if their status code is transient.
+func temporary(err error) bool {
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case *oauth2.RetrieveError:
+		return e.Response != nil && transientStatus(e.Response.StatusCode)
+	case net.Error:
+		return true
+	}
+	return cause == io.EOF || cause == io.ErrUnexpectedEOF
+}
+
+// transientStatus returns true for the status codes that may go away
+func transientStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header, both in seconds and as an http date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
@@ -0,0 +1,199 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package common_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+var testPolicy = common.RetryPolicy{
+	MaxAttempts: 3,
+	MinBackoff:  time.Millisecond,
+	MaxBackoff:  10 * time.Millisecond,
+}
+
+// flaky returns a server that fails with the given status code the first n times
+func flaky(n, code int, calls *int, header http.Header) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if *calls <= n {
+			for k := range header {
+				w.Header().Set(k, header.Get(k))
+			}
+			w.WriteHeader(code)
+			return
+		}
+		w.Write([]byte(`{"body":"` + string(body) + `"}`))
+	}))
+}
+
+func TestRetry(t *testing.T) {
+	calls := 0
+	server := flaky(2, http.StatusServiceUnavailable, &calls, nil)
+	defer server.Close()
+
+	client := common.WithRetry(http.DefaultClient, testPolicy)
+
+	req, _ := http.NewRequest("PUT", server.URL, bytes.NewBufferString("payload"))
+	var res struct {
+		Body string `json:"body"`
+	}
+	err := common.Bind(client, req, &res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+	if res.Body != "payload" {
+		t.Errorf("Expected the body to be sent again, got '%s'", res.Body)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	calls := 0
+	server := flaky(5, http.StatusBadGateway, &calls, nil)
+	defer server.Close()
+
+	client := common.WithRetry(http.DefaultClient, testPolicy)
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	err := common.Bind(client, req, nil)
+	if !common.HasStatusCode(err, http.StatusBadGateway) {
+		t.Errorf("Expected a bad gateway error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestRetryPost(t *testing.T) {
+	calls := 0
+	server := flaky(1, http.StatusServiceUnavailable, &calls, nil)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, bytes.NewBufferString("payload"))
+	err := common.Bind(common.WithRetry(http.DefaultClient, testPolicy), req, nil)
+	if err == nil || calls != 1 {
+		t.Errorf("Expected POST not to be retried, got %d calls", calls)
+	}
+
+	policy := testPolicy
+	policy.RetryPost = true
+	req, _ = http.NewRequest("POST", server.URL, bytes.NewBufferString("payload"))
+	var res struct{}
+	err = common.Bind(common.WithRetry(http.DefaultClient, policy), req, &res)
+	if err != nil || calls != 2 {
+		t.Errorf("Expected POST to be retried, got %d calls and %v", calls, err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	calls := 0
+	server := flaky(1, http.StatusTooManyRequests, &calls, http.Header{"Retry-After": {"60"}})
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	err := common.Bind(common.WithRetry(http.DefaultClient, testPolicy), req, nil)
+	if !common.HasStatusCode(err, http.StatusTooManyRequests) || calls != 1 {
+		t.Errorf("Expected to give up when Retry-After exceeds the max backoff, got %d calls and %v", calls, err)
+	}
+
+	calls = 0
+	server = flaky(1, http.StatusTooManyRequests, &calls, http.Header{"Retry-After": {"1"}})
+	defer server.Close()
+
+	policy := testPolicy
+	policy.MaxBackoff = 2 * time.Second
+
+	start := time.Now()
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	var res struct{}
+	err = common.Bind(common.WithRetry(http.DefaultClient, policy), req, &res)
+	if err != nil || calls != 2 {
+		t.Errorf("Expected to retry after a second, got %d calls and %v", calls, err)
+	}
+	if time.Since(start) < time.Second {
+		t.Errorf("Expected to wait at least a second, waited %s", time.Since(start))
+	}
+}
+
+// failing is a RoundTripper that always fails with the given error
+type failing struct {
+	err   error
+	calls int
+}
+
+func (f *failing) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.calls++
+	return nil, f.err
+}
+
+func TestRetryErrors(t *testing.T) {
+	rejected := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusUnauthorized}}
+	unavailable := &oauth2.RetrieveError{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}}
+
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, 3},
+		{"token rejected", rejected, 1},
+		{"wrapped token rejected", errors.Wrap(rejected, "token"), 1},
+		{"token endpoint unavailable", unavailable, 3},
+		{"other error", errors.New("malformed request"), 1},
+	}
+
+	for _, test := range tests {
+		base := &failing{err: test.err}
+		client := common.WithRetry(&http.Client{Transport: base}, testPolicy)
+
+		req, _ := http.NewRequest("GET", "http://hydra.invalid/clients", nil)
+		_, err := client.Do(req)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+		if base.calls != test.calls {
+			t.Errorf("%s: expected %d calls, got %d", test.name, test.calls, base.calls)
+		}
+	}
+}
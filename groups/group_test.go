@@ -33,10 +33,14 @@ import (
 	"testing"
 
 	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
 )
 
 func TestCreateGroup(t *testing.T) {
-	manager, err := groups.NewManager("admin", "demo-password", "http://localhost:4444")
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := groups.NewManager("admin", "demo-password", server.URL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -106,7 +110,10 @@ func TestCreateGroup(t *testing.T) {
 }
 
 func TestMembers(t *testing.T) {
-	manager, err := groups.NewManager("admin", "demo-password", "http://localhost:4444")
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := groups.NewManager("admin", "demo-password", server.URL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -37,12 +37,14 @@ import (
 
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 // Manager provides methods to create and update ladon groups
 type Manager struct {
-	Endpoint *url.URL
-	Client   *http.Client
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	Client         *http.Client
 }
 
 // Group allows or denies certain Subjects to perform certain Actions on certain Resources.
@@ -55,25 +57,43 @@ type Group struct {
 // NewManager returns a Manager connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewManager(id, secret, cluster string) (*Manager, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewManagerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewManagerWithOptions returns a Manager connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewManagerWithOptions(cluster string, opts ...common.Option) (*Manager, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate ClientManager")
 	}
 	manager := Manager{
-		Endpoint: common.JoinURL(endpoint, "warden", "groups"),
-		Client:   client,
+		Endpoint:       common.JoinURL(endpoint, "warden", "groups"),
+		HealthEndpoint: common.JoinURL(endpoint, "health", "status"),
+		Client:         client,
 	}
 	return &manager, nil
 }
 
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Manager) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
 // List calls the hydra api to list all groups
 func (m *Manager) List() ([]string, error) {
+	return m.ListCtx(context.Background())
+}
+
+// ListCtx is like List, but the request is bound to the given context
+func (m *Manager) ListCtx(ctx context.Context) ([]string, error) {
 	url := m.Endpoint.String()
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	var groups []string
 
@@ -86,6 +106,11 @@ func (m *Manager) List() ([]string, error) {
 
 // Create calls the hydra api to create a new group
 func (m *Manager) Create(group *Group) error {
+	return m.CreateCtx(context.Background(), group)
+}
+
+// CreateCtx is like Create, but the request is bound to the given context
+func (m *Manager) CreateCtx(ctx context.Context, group *Group) error {
 	url := m.Endpoint.String()
 
 	payload, err := json.Marshal(group)
@@ -97,6 +122,7 @@ func (m *Manager) Create(group *Group) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, &group)
 	if err != nil {
@@ -107,6 +133,11 @@ func (m *Manager) Create(group *Group) error {
 
 // OfUser calls the hydra api to return the groups of a user
 func (m *Manager) OfUser(id string) ([]string, error) {
+	return m.OfUserCtx(context.Background(), id)
+}
+
+// OfUserCtx is like OfUser, but the request is bound to the given context
+func (m *Manager) OfUserCtx(ctx context.Context, id string) ([]string, error) {
 	url := common.CopyURL(m.Endpoint)
 	values := url.Query()
 	values.Add("member", id)
@@ -116,6 +147,7 @@ func (m *Manager) OfUser(id string) ([]string, error) {
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	var groups []string
 
@@ -128,6 +160,11 @@ func (m *Manager) OfUser(id string) ([]string, error) {
 
 // AddMembers calls the hydra api to add members to a group
 func (m *Manager) AddMembers(id string, members []string) error {
+	return m.AddMembersCtx(context.Background(), id, members)
+}
+
+// AddMembersCtx is like AddMembers, but the request is bound to the given context
+func (m *Manager) AddMembersCtx(ctx context.Context, id string, members []string) error {
 	url := common.JoinURL(m.Endpoint, id, "members").String()
 
 	payload, err := json.Marshal(struct {
@@ -141,6 +178,7 @@ func (m *Manager) AddMembers(id string, members []string) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -151,6 +189,11 @@ func (m *Manager) AddMembers(id string, members []string) error {
 
 // RemoveMembers calls the hydra api to remove members to a group
 func (m *Manager) RemoveMembers(id string, members []string) error {
+	return m.RemoveMembersCtx(context.Background(), id, members)
+}
+
+// RemoveMembersCtx is like RemoveMembers, but the request is bound to the given context
+func (m *Manager) RemoveMembersCtx(ctx context.Context, id string, members []string) error {
 	url := common.JoinURL(m.Endpoint, id, "members").String()
 
 	payload, err := json.Marshal(struct {
@@ -164,6 +207,7 @@ func (m *Manager) RemoveMembers(id string, members []string) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -174,12 +218,18 @@ func (m *Manager) RemoveMembers(id string, members []string) error {
 
 // Get calls the hydra api to return a specific group
 func (m *Manager) Get(id string) (*Group, error) {
+	return m.GetCtx(context.Background(), id)
+}
+
+// GetCtx is like Get, but the request is bound to the given context
+func (m *Manager) GetCtx(ctx context.Context, id string) (*Group, error) {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	var group Group
 
@@ -192,12 +242,18 @@ func (m *Manager) Get(id string) (*Group, error) {
 
 // Delete calls the hydra api to remove a specific Group
 func (m *Manager) Delete(id string) error {
+	return m.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but the request is bound to the given context
+func (m *Manager) DeleteCtx(ctx context.Context, id string) error {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -0,0 +1,176 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+// Package hydrasdk is a lightweight sdk for https://www.ory.am/products/hydra
+// The sdk that they provide is more complete but also huge.
+//
+// New returns a Client that shares a single authenticated http client between every api:
+//
+//	sdk, err := hydrasdk.New(hydrasdk.Config{
+//		Cluster:      "http://localhost:4444",
+//		ClientID:     "admin",
+//		ClientSecret: "demo-password",
+//	})
+//	err = sdk.Warden().IsAllowed(ctx, &ladon.Request{Subject: "me", Action: "eat", Resource: "banana"})
+package hydrasdk
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/clients"
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Config describes how to connect to the hydra cluster
+type Config struct {
+	// Cluster is the url of hydra
+	Cluster string
+	// ClientID and ClientSecret, if not empty, authenticate with the client credentials grant
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested with the client credentials. They default to hydra.
+	Scopes []string
+	// Options customize the connection, for example with a different authentication or a retry policy
+	Options []common.Option
+}
+
+// Client gives access to every hydra api through a single authenticated http client,
+// so that there's a single token exchange and a single connection pool
+type Client struct {
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	HTTPClient     *http.Client
+
+	clients      *clients.Manager
+	policies     *policies.Manager
+	groups       *groups.Manager
+	keys         *keys.CachedKeyManager
+	keySets      *keys.Manager
+	warden       *authorizer.Authorizer
+	introspector *introspect.Introspector
+}
+
+// New returns a Client connected to the hydra cluster
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func New(config Config) (*Client, error) {
+	opts := []common.Option{}
+	if config.ClientID != "" {
+		scopes := config.Scopes
+		if len(scopes) == 0 {
+			scopes = []string{"hydra"}
+		}
+		opts = append(opts, common.WithClientCredentials(config.ClientID, config.ClientSecret, scopes...))
+	}
+	opts = append(opts, config.Options...)
+
+	endpoint, client, err := common.Connect(config.Cluster, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+
+	// The managers use the authenticated client as is
+	shared := common.WithHTTPClient(client)
+
+	c := Client{
+		Endpoint:       endpoint,
+		HealthEndpoint: common.JoinURL(endpoint, "health", "status"),
+		HTTPClient:     client,
+	}
+	if c.clients, err = clients.NewManagerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.policies, err = policies.NewManagerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.groups, err = groups.NewManagerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.keys, err = keys.NewCachedKeyManagerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.keySets, err = keys.NewManagerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.warden, err = authorizer.NewAuthorizerWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	if c.introspector, err = introspect.NewIntrospectorWithOptions(config.Cluster, shared); err != nil {
+		return nil, errors.Wrap(err, "Instantiate Client")
+	}
+	return &c, nil
+}
+
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (c *Client) Ping(ctx context.Context) error {
+	return common.Ping(ctx, c.HTTPClient, c.HealthEndpoint)
+}
+
+// Clients returns the manager of the oauth2 clients
+func (c *Client) Clients() *clients.Manager {
+	return c.clients
+}
+
+// Policies returns the manager of the ladon policies
+func (c *Client) Policies() *policies.Manager {
+	return c.policies
+}
+
+// Groups returns the manager of the warden groups
+func (c *Client) Groups() *groups.Manager {
+	return c.groups
+}
+
+// Keys returns the manager of the json web keys. It caches the keys, so the same one
+// should be used for the whole life of the application.
+func (c *Client) Keys() *keys.CachedKeyManager {
+	return c.keys
+}
+
+// KeySets returns the manager that creates, imports and deletes the json web keys
+func (c *Client) KeySets() *keys.Manager {
+	return c.keySets
+}
+
+// Warden returns the authorizer that checks the permissions of the subjects
+func (c *Client) Warden() *authorizer.Authorizer {
+	return c.warden
+}
+
+// Introspection returns the introspector of the access tokens
+func (c *Client) Introspection() *introspect.Introspector {
+	return c.introspector
+}
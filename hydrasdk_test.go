@@ -0,0 +1,102 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package hydrasdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk"
+	"github.com/bcmi-labs/hydrasdk/clients"
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/codeclysm/introspector/v3"
+	"github.com/ory/ladon"
+)
+
+func TestNew(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+
+	sdk, err := hydrasdk.New(hydrasdk.Config{
+		Cluster:      server.URL,
+		ClientID:     "admin",
+		ClientSecret: "demo-password",
+		Options:      []common.Option{common.Lazy()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sdk.Ping(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := sdk.Clients().Create(&clients.Client{ID: "client"}); err != nil {
+		t.Error(err)
+	}
+	if err := sdk.Groups().Create(&groups.Group{ID: "hungry", Members: []string{"me"}}); err != nil {
+		t.Error(err)
+	}
+	err = sdk.Policies().Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"hungry"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	if err := sdk.Warden().IsAllowed(context.Background(), &ladon.Request{Subject: "me", Action: "eat", Resource: "banana"}); err != nil {
+		t.Error(err)
+	}
+	if _, err := sdk.Introspection().Introspect("token"); err != nil {
+		t.Error(err)
+	}
+	if _, err := sdk.Keys().GetRSAPublic("missing"); !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if _, err := sdk.KeySets().Create("signing", "ES256", "", "sig"); err != nil {
+		t.Error(err)
+	}
+
+	if calls := server.Calls("/oauth2/token"); calls != 1 {
+		t.Errorf("Expected a single token exchange, got %d", calls)
+	}
+}
@@ -0,0 +1,546 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+// Package hydratest provides an in-process fake of the hydra apis used by the sdk,
+// so that the managers can be exercised without a running cluster.
+//
+//	server := hydratest.NewServer()
+//	defer server.Close()
+//
+//	manager, err := policies.NewManager("admin", "demo-password", server.URL)
+package hydratest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/clients"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/codeclysm/introspector/v3"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Server is an httptest.Server that emulates the hydra rest apis with an in-memory state
+type Server struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the credentials accepted by the token endpoint.
+	// They default to admin and demo-password, like a freshly installed hydra.
+	ClientID     string
+	ClientSecret string
+
+	mu            sync.Mutex
+	tokens        map[string]introspector.Introspection
+	clients       map[string]clients.Client
+	policies      map[string]policies.Policy
+	groups        map[string]groups.Group
+	keys          map[string]jose.JSONWebKeySet
+	calls         map[string]int
+	failures      map[string]int
+	assertionKeys map[string]jose.JSONWebKey
+}
+
+// NewServer starts and returns a new fake hydra cluster. The caller should call Close
+// when finished, to shut it down.
+// The cluster starts with a single policy granting the admin client every permission
+// on the hydra resources, like the one hydra creates on its first run.
+func NewServer() *Server {
+	s := &Server{
+		ClientID:      "admin",
+		ClientSecret:  "demo-password",
+		tokens:        map[string]introspector.Introspection{},
+		clients:       map[string]clients.Client{},
+		policies:      map[string]policies.Policy{},
+		groups:        map[string]groups.Group{},
+		keys:          map[string]jose.JSONWebKeySet{},
+		calls:         map[string]int{},
+		failures:      map[string]int{},
+		assertionKeys: map[string]jose.JSONWebKey{},
+	}
+
+	s.policies["admin-policy"] = policies.Policy{
+		ID:          "admin-policy",
+		Description: "Grants all of hydra's administrative privileges to the admin client",
+		Subjects:    []string{s.ClientID},
+		Effect:      "allow",
+		Resources:   []string{"rn:hydra:<.*>"},
+		Actions:     []string{"<.*>"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/status", s.health)
+	mux.HandleFunc("/oauth2/token", s.token)
+	mux.HandleFunc("/oauth2/introspect", s.authenticated(s.introspect))
+	mux.HandleFunc("/clients", s.authenticated(s.clientsHandler))
+	mux.HandleFunc("/clients/", s.authenticated(s.clientsHandler))
+	mux.HandleFunc("/policies", s.authenticated(s.policiesHandler))
+	mux.HandleFunc("/policies/", s.authenticated(s.policiesHandler))
+	mux.HandleFunc("/warden/groups", s.authenticated(s.groupsHandler))
+	mux.HandleFunc("/warden/groups/", s.authenticated(s.groupsHandler))
+	mux.HandleFunc("/warden/allowed", s.authenticated(s.allowed))
+	mux.HandleFunc("/warden/token/allowed", s.authenticated(s.tokenAllowed))
+	mux.HandleFunc("/keys/", s.authenticated(s.keysHandler))
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[r.URL.Path]++
+		code := s.failures[r.URL.Path]
+		s.mu.Unlock()
+
+		if code != 0 {
+			writeError(w, code, http.StatusText(code))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+// Calls returns how many requests the server received on the given path
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// Fail makes the server answer to every request on the given path with the status code,
+// to emulate a failure of hydra. A zero code restores the normal behavior.
+func (s *Server) Fail(path string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code == 0 {
+		delete(s.failures, path)
+		return
+	}
+	s.failures[path] = code
+}
+
+// AddToken registers a token, so that the introspection endpoint recognizes it
+func (s *Server) AddToken(token string, i introspector.Introspection) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = i
+}
+
+// AddKeySet stores the given keys under the set, replacing any existing key
+func (s *Server) AddKeySet(set string, keys jose.JSONWebKeySet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[set] = keys
+}
+
+// AddAssertionKey registers a client that authenticates to the token endpoint with
+// jwts signed by the given key, instead of a secret
+func (s *Server) AddAssertionKey(id string, key jose.JSONWebKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.assertionKeys[id] = key
+}
+
+// authenticated rejects the requests without a valid access token
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			writeError(w, http.StatusUnauthorized, "The request is missing a bearer token")
+			return
+		}
+
+		s.mu.Lock()
+		i, ok := s.tokens[strings.TrimPrefix(header, "Bearer ")]
+		s.mu.Unlock()
+
+		if !ok || i.Valid() != nil {
+			writeError(w, http.StatusUnauthorized, "The bearer token is not valid")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// health reports that the server is alive, without requiring authentication
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// token implements the client credentials grant of the token endpoint
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "Only the client_credentials grant is supported")
+		return
+	}
+
+	var id string
+	var err error
+	if r.PostForm.Get("client_assertion_type") == "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" {
+		id, err = s.verifyAssertion(r)
+	} else {
+		id, err = s.verifySecret(r)
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	now := time.Now()
+	token := randomID()
+	scope := r.PostForm.Get("scope")
+	s.AddToken(token, introspector.Introspection{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  id,
+		Subject:   id,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "bearer",
+		"expires_in":   3600,
+		"scope":        scope,
+	})
+}
+
+// verifySecret checks the client id and secret, either in the basic auth or in the form
+func (s *Server) verifySecret(r *http.Request) (string, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	if id != s.ClientID || secret != s.ClientSecret {
+		return "", errors.New("The client credentials are not valid")
+	}
+	return id, nil
+}
+
+// verifyAssertion checks the jwt used by the client to authenticate, as described in
+// https://tools.ietf.org/html/rfc7523#section-2.2
+func (s *Server) verifyAssertion(r *http.Request) (string, error) {
+	token, err := jwt.ParseSigned(r.PostForm.Get("client_assertion"))
+	if err != nil {
+		return "", errors.Wrap(err, "The client assertion is malformed")
+	}
+
+	var claims jwt.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", errors.Wrap(err, "The client assertion is malformed")
+	}
+
+	s.mu.Lock()
+	key, ok := s.assertionKeys[claims.Subject]
+	s.mu.Unlock()
+	if !ok {
+		return "", errors.New("The client is not allowed to use assertions")
+	}
+
+	if err := token.Claims(key.Public(), &claims); err != nil {
+		return "", errors.Wrap(err, "The client assertion signature is not valid")
+	}
+	err = claims.Validate(jwt.Expected{
+		Issuer:   claims.Subject,
+		Audience: jwt.Audience{"http://" + r.Host + "/oauth2/token"},
+		Time:     time.Now(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "The client assertion is not valid")
+	}
+	return claims.Subject, nil
+}
+
+// introspect implements https://tools.ietf.org/html/rfc7662
+func (s *Server) introspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	i, ok := s.tokens[r.PostForm.Get("token")]
+	s.mu.Unlock()
+
+	if !ok || i.Valid() != nil {
+		writeJSON(w, http.StatusOK, introspector.Introspection{Active: false})
+		return
+	}
+	writeJSON(w, http.StatusOK, i)
+}
+
+// clientsHandler serves /clients and /clients/{id}
+func (s *Server) clientsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/clients"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case id == "" && r.Method == "GET":
+		list := map[string]clients.Client{}
+		for k, c := range s.clients {
+			c.Secret = ""
+			list[k] = c
+		}
+		writeJSON(w, http.StatusOK, list)
+	case id == "" && r.Method == "POST":
+		var client clients.Client
+		if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if client.ID == "" {
+			client.ID = randomID()
+		}
+		if _, ok := s.clients[client.ID]; ok {
+			writeError(w, http.StatusConflict, "A client with the same id already exists")
+			return
+		}
+		if client.Secret == "" && !client.Public {
+			client.Secret = randomID()
+		}
+		s.clients[client.ID] = client
+		writeJSON(w, http.StatusCreated, client)
+	case id != "" && r.Method == "GET":
+		client, ok := s.clients[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested client")
+			return
+		}
+		client.Secret = ""
+		writeJSON(w, http.StatusOK, client)
+	case id != "" && r.Method == "PUT":
+		old, ok := s.clients[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested client")
+			return
+		}
+		var client clients.Client
+		if err := json.NewDecoder(r.Body).Decode(&client); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		client.ID = id
+		if client.Secret == "" {
+			client.Secret = old.Secret
+		}
+		s.clients[id] = client
+		client.Secret = ""
+		writeJSON(w, http.StatusOK, client)
+	case id != "" && r.Method == "DELETE":
+		if _, ok := s.clients[id]; !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested client")
+			return
+		}
+		delete(s.clients, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// keysHandler serves /keys/{set} and /keys/{set}/{kid}
+func (s *Server) keysHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/keys"), "/"), "/", 2)
+	set := parts[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keyset, ok := s.keys[set]
+
+	switch {
+	case len(parts) == 1 && r.Method == "POST":
+		var request struct {
+			Algorithm string `json:"alg"`
+			KeyID     string `json:"kid"`
+			Use       string `json:"use"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if request.KeyID == "" {
+			request.KeyID = randomID()
+		}
+		generated, err := generateKey(request.Algorithm, request.KeyID, request.Use)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		keyset.Keys = append(keyset.Keys, generated.Keys...)
+		s.keys[set] = keyset
+		writeJSON(w, http.StatusCreated, generated)
+	case len(parts) == 2 && r.Method == "PUT":
+		var key jose.JSONWebKey
+		if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if key.KeyID != parts[1] {
+			writeError(w, http.StatusBadRequest, "The key id doesn't match the url")
+			return
+		}
+		replaced := false
+		for i := range keyset.Keys {
+			if keyset.Keys[i].KeyID == key.KeyID && keyset.Keys[i].IsPublic() == key.IsPublic() {
+				keyset.Keys[i] = key
+				replaced = true
+			}
+		}
+		if !replaced {
+			keyset.Keys = append(keyset.Keys, key)
+		}
+		s.keys[set] = keyset
+		writeJSON(w, http.StatusOK, key)
+	case !ok:
+		writeError(w, http.StatusNotFound, "Unable to locate the requested key set")
+	case len(parts) == 1 && r.Method == "GET":
+		writeJSON(w, http.StatusOK, keyset)
+	case len(parts) == 2 && r.Method == "GET":
+		found := keyset.Key(parts[1])
+		if len(found) == 0 {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested key")
+			return
+		}
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: found})
+	case len(parts) == 1 && r.Method == "DELETE":
+		delete(s.keys, set)
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && r.Method == "DELETE":
+		kept := []jose.JSONWebKey{}
+		for _, key := range keyset.Keys {
+			if key.KeyID != parts[1] {
+				kept = append(kept, key)
+			}
+		}
+		if len(kept) == len(keyset.Keys) {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested key")
+			return
+		}
+		s.keys[set] = jose.JSONWebKeySet{Keys: kept}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// generateKey creates a key like hydra does: the private and the public halves share
+// the same id, while the symmetric keys are a single one
+func generateKey(alg, kid, use string) (jose.JSONWebKeySet, error) {
+	var private interface{}
+	var public interface{}
+	var err error
+
+	switch alg {
+	case "RS256", "PS256", "RSA-OAEP-256":
+		var key *rsa.PrivateKey
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		private, public = key, &key.PublicKey
+	case "ES256", "ES512", "ECDH-ES":
+		curve := elliptic.P256()
+		if alg == "ES512" {
+			curve = elliptic.P521()
+		}
+		var key *ecdsa.PrivateKey
+		key, err = ecdsa.GenerateKey(curve, rand.Reader)
+		private, public = key, &key.PublicKey
+	case "HS256", "HS512":
+		secret := make([]byte, 32)
+		if alg == "HS512" {
+			secret = make([]byte, 64)
+		}
+		_, err = rand.Read(secret)
+		private = secret
+	default:
+		return jose.JSONWebKeySet{}, errors.Errorf("unknown algorithm %s", alg)
+	}
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+
+	keyset := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: private, KeyID: kid, Algorithm: alg, Use: use},
+	}}
+	if public != nil {
+		keyset.Keys = append(keyset.Keys, jose.JSONWebKey{Key: public, KeyID: kid, Algorithm: alg, Use: use})
+	}
+	return keyset, nil
+}
+
+// writeJSON encodes the value as the body of the response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the same format used by hydra
+func writeError(w http.ResponseWriter, code int, description string) {
+	writeJSON(w, code, map[string]interface{}{
+		"error":             http.StatusText(code),
+		"error_description": description,
+		"status_code":       code,
+		"request_id":        randomID(),
+	})
+}
+
+// randomID returns a random hex string, suitable for ids, secrets and tokens
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,293 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package hydratest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/authorizer"
+	"github.com/bcmi-labs/hydrasdk/groups"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/ory/ladon"
+	"golang.org/x/net/context"
+)
+
+// policiesHandler serves /policies and /policies/{id}
+func (s *Server) policiesHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/policies"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case id == "" && r.Method == "GET":
+		list := []policies.Policy{}
+		for _, p := range s.policies {
+			list = append(list, p)
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+		writeJSON(w, http.StatusOK, list)
+	case id == "" && r.Method == "POST":
+		var policy policies.Policy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if policy.ID == "" {
+			policy.ID = randomID()
+		}
+		if _, ok := s.policies[policy.ID]; ok {
+			writeError(w, http.StatusConflict, "A policy with the same id already exists")
+			return
+		}
+		s.policies[policy.ID] = policy
+		writeJSON(w, http.StatusCreated, policy)
+	case id != "" && r.Method == "GET":
+		policy, ok := s.policies[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested policy")
+			return
+		}
+		writeJSON(w, http.StatusOK, policy)
+	case id != "" && r.Method == "PUT":
+		if _, ok := s.policies[id]; !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested policy")
+			return
+		}
+		var policy policies.Policy
+		if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		policy.ID = id
+		s.policies[id] = policy
+		writeJSON(w, http.StatusOK, policy)
+	case id != "" && r.Method == "DELETE":
+		if _, ok := s.policies[id]; !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested policy")
+			return
+		}
+		delete(s.policies, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// groupsHandler serves /warden/groups, /warden/groups/{id} and /warden/groups/{id}/members
+func (s *Server) groupsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/warden/groups"), "/"), "/")
+	id := parts[0]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case id == "" && r.Method == "GET":
+		list := []string{}
+		member := r.URL.Query().Get("member")
+		for _, g := range s.groups {
+			if member == "" || contains(g.Members, member) {
+				list = append(list, g.ID)
+			}
+		}
+		sort.Strings(list)
+		writeJSON(w, http.StatusOK, list)
+	case id == "" && r.Method == "POST":
+		var group groups.Group
+		if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if group.ID == "" {
+			group.ID = randomID()
+		}
+		if _, ok := s.groups[group.ID]; ok {
+			writeError(w, http.StatusConflict, "A group with the same id already exists")
+			return
+		}
+		s.groups[group.ID] = group
+		writeJSON(w, http.StatusCreated, group)
+	case len(parts) == 1 && r.Method == "GET":
+		group, ok := s.groups[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested group")
+			return
+		}
+		writeJSON(w, http.StatusOK, group)
+	case len(parts) == 1 && r.Method == "DELETE":
+		if _, ok := s.groups[id]; !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested group")
+			return
+		}
+		delete(s.groups, id)
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "members" && (r.Method == "POST" || r.Method == "DELETE"):
+		group, ok := s.groups[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Unable to locate the requested group")
+			return
+		}
+		var payload struct {
+			Members []string `json:"members"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		members := []string{}
+		for _, m := range group.Members {
+			if !contains(payload.Members, m) {
+				members = append(members, m)
+			}
+		}
+		if r.Method == "POST" {
+			members = append(members, payload.Members...)
+		}
+		group.Members = members
+		s.groups[id] = group
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, r.Method+" is not supported")
+	}
+}
+
+// allowed serves /warden/allowed
+func (s *Server) allowed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST")
+		return
+	}
+
+	var request ladon.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	allowed, err := s.isAllowed(&request)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"allowed": allowed})
+}
+
+// tokenAllowed serves /warden/token/allowed
+func (s *Server) tokenAllowed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Use POST")
+		return
+	}
+
+	var request struct {
+		ladon.Request
+		Token  string   `json:"token"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, ok := s.tokens[request.Token]
+	if !ok || i.Valid() != nil {
+		writeJSON(w, http.StatusOK, map[string]bool{"allowed": false})
+		return
+	}
+
+	granted := strings.Fields(i.Scope)
+	for _, scope := range request.Scopes {
+		if !contains(granted, scope) {
+			writeJSON(w, http.StatusOK, map[string]bool{"allowed": false})
+			return
+		}
+	}
+
+	request.Subject = i.Subject
+	allowed, err := s.isAllowed(&request.Request)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !allowed {
+		writeJSON(w, http.StatusOK, map[string]bool{"allowed": false})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"allowed": true,
+		"sub":     i.Subject,
+		"scopes":  granted,
+		"iss":     i.Issuer,
+		"aud":     i.Audience,
+		"iat":     time.Unix(i.IssuedAt, 0).UTC(),
+		"exp":     time.Unix(i.ExpiresAt, 0).UTC(),
+		"ext":     i.Extra,
+	})
+}
+
+// isAllowed evaluates the request against the stored policies with the same code of the
+// local authorizer, so that they follow the same semantics. It must be called with the lock held.
+func (s *Server) isAllowed(request *ladon.Request) (bool, error) {
+	policyList := make([]policies.Policy, 0, len(s.policies))
+	for _, p := range s.policies {
+		policyList = append(policyList, p)
+	}
+	groupList := make([]groups.Group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groupList = append(groupList, g)
+	}
+
+	snapshot, err := authorizer.NewSnapshot(policyList, groupList)
+	if err != nil {
+		return false, err
+	}
+	return authorizer.Decide(context.Background(), snapshot, request)
+}
+
+func contains(slice []string, el string) bool {
+	for i := range slice {
+		if slice[i] == el {
+			return true
+		}
+	}
+	return false
+}
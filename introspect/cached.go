@@ -0,0 +1,107 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/codeclysm/introspector/v3"
+	"golang.org/x/net/context"
+)
+
+// CachedIntrospector wraps an Introspector and keeps the introspections in memory.
+// Active tokens are cached until they expire, but never longer than MaxTTL.
+// Inactive tokens are cached for NegativeTTL. Other errors are never cached.
+// The tokens themselves are not stored, only their sha256 digest.
+type CachedIntrospector struct {
+	Introspector *Introspector
+	MaxTTL       time.Duration
+	NegativeTTL  time.Duration
+
+	cache *common.Cache
+}
+
+// NewCachedIntrospector returns a CachedIntrospector that keeps up to size introspections,
+// evicting the least recently used ones
+func NewCachedIntrospector(i *Introspector, size int, maxTTL, negativeTTL time.Duration) *CachedIntrospector {
+	return &CachedIntrospector{
+		Introspector: i,
+		MaxTTL:       maxTTL,
+		NegativeTTL:  negativeTTL,
+		cache:        common.NewCache(size),
+	}
+}
+
+// Introspect returns the cached introspection of the token, querying hydra if there's none
+func (c *CachedIntrospector) Introspect(token string) (introspector.Introspection, error) {
+	return c.IntrospectCtx(context.Background(), token)
+}
+
+// IntrospectCtx is like Introspect, but the request is bound to the given context
+func (c *CachedIntrospector) IntrospectCtx(ctx context.Context, token string) (introspector.Introspection, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+
+	if cached, ok := c.cache.Get(key); ok {
+		i := cached.(introspector.Introspection)
+		if !i.Active {
+			return introspector.Introspection{}, introspector.ErrNotActive
+		}
+		return i, nil
+	}
+
+	i, err := c.Introspector.IntrospectCtx(ctx, token)
+	switch {
+	case err == introspector.ErrNotActive:
+		c.cache.Set(key, introspector.Introspection{Active: false}, c.NegativeTTL)
+	case err == nil:
+		ttl := c.MaxTTL
+		if i.ExpiresAt != 0 {
+			if untilExpiry := time.Until(time.Unix(i.ExpiresAt, 0)); untilExpiry < ttl {
+				ttl = untilExpiry
+			}
+		}
+		c.cache.Set(key, i, ttl)
+	}
+	return i, err
+}
+
+// Stats returns the hits and misses of the cache
+func (c *CachedIntrospector) Stats() common.CacheStats {
+	return c.cache.Stats()
+}
+
+// Purge forgets every cached introspection, for example after revoking some tokens
+func (c *CachedIntrospector) Purge() {
+	c.cache.Purge()
+}
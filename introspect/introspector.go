@@ -31,26 +31,51 @@ package introspect
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/url"
 	"strconv"
+	"time"
 
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/codeclysm/introspector/v3"
+	"github.com/ory/ladon"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
+// ErrTokenNotAllowed is returned by IsTokenAllowed when hydra denies the request
+var ErrTokenNotAllowed = errors.New("token not allowed")
+
+// TokenContext describes the owner and the grants of a token authorized by hydra's warden
+type TokenContext struct {
+	Subject   string                 `json:"sub"`
+	Scopes    []string               `json:"scopes"`
+	Issuer    string                 `json:"iss"`
+	Audience  string                 `json:"aud"`
+	IssuedAt  time.Time              `json:"iat"`
+	ExpiresAt time.Time              `json:"exp"`
+	Extra     map[string]interface{} `json:"ext"`
+}
+
 // Introspector uses hydra rest apis to retrieve clients
 type Introspector struct {
 	AllowedEndpoint    *url.URL
 	IntrospectEndpoint *url.URL
+	HealthEndpoint     *url.URL
 	Client             *http.Client
 }
 
 // NewIntrospector returns a Introspector connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewIntrospector(id, secret, cluster string) (*Introspector, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewIntrospectorWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewIntrospectorWithOptions returns an Introspector connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewIntrospectorWithOptions(cluster string, opts ...common.Option) (*Introspector, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate Introspector")
 	}
@@ -58,14 +83,26 @@ func NewIntrospector(id, secret, cluster string) (*Introspector, error) {
 	manager := Introspector{
 		AllowedEndpoint:    common.JoinURL(endpoint, "warden", "token", "allowed"),
 		IntrospectEndpoint: common.JoinURL(endpoint, "oauth2", "introspect"),
+		HealthEndpoint:     common.JoinURL(endpoint, "health", "status"),
 		Client:             client,
 	}
 	return &manager, nil
 }
 
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Introspector) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
 // Introspect queries the endpoint with an http request. It expects that the endpoint
 // implements https://tools.ietf.org/html/rfc7662
+// It returns introspector.ErrNotActive if the token is not active.
 func (m *Introspector) Introspect(token string) (introspector.Introspection, error) {
+	return m.IntrospectCtx(context.Background(), token)
+}
+
+// IntrospectCtx is like Introspect, but the request is bound to the given context
+func (m *Introspector) IntrospectCtx(ctx context.Context, token string) (introspector.Introspection, error) {
 	data := url.Values{
 		"token": []string{token},
 	}
@@ -75,6 +112,7 @@ func (m *Introspector) Introspect(token string) (introspector.Introspection, err
 	if err != nil {
 		return introspector.Introspection{}, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
@@ -86,8 +124,54 @@ func (m *Introspector) Introspect(token string) (introspector.Introspection, err
 	}
 
 	if !i.Active {
-		return introspector.Introspection{}, errors.New("token not active")
+		return introspector.Introspection{}, introspector.ErrNotActive
 	}
 
 	return i, nil
 }
+
+// IsTokenAllowed calls the hydra endpoint to see if the owner of the token has the permission to perform
+// an action on a resource, and if the token was granted the scopes. It returns the subject and the claims
+// of the token, or ErrTokenNotAllowed if the request is denied.
+func (m *Introspector) IsTokenAllowed(token, resource, action string, scopes []string, requestContext ladon.Context) (*TokenContext, error) {
+	return m.IsTokenAllowedCtx(context.Background(), token, resource, action, scopes, requestContext)
+}
+
+// IsTokenAllowedCtx is like IsTokenAllowed, but the request is bound to the given context
+func (m *Introspector) IsTokenAllowedCtx(ctx context.Context, token, resource, action string, scopes []string, requestContext ladon.Context) (*TokenContext, error) {
+	data, err := json.Marshal(struct {
+		Token    string        `json:"token"`
+		Scopes   []string      `json:"scopes"`
+		Resource string        `json:"resource"`
+		Action   string        `json:"action"`
+		Context  ladon.Context `json:"context"`
+	}{token, scopes, resource, action, requestContext})
+	if err != nil {
+		return nil, errors.Wrapf(err, "marshal request")
+	}
+
+	url := m.AllowedEndpoint.String()
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Length", strconv.Itoa(len(data)))
+
+	var res struct {
+		TokenContext
+		Allowed bool `json:"allowed"`
+	}
+	err = common.Bind(m.Client, req, &res)
+	if err != nil {
+		return nil, err
+	}
+
+	if !res.Allowed {
+		return nil, ErrTokenNotAllowed
+	}
+
+	return &res.TokenContext, nil
+}
@@ -0,0 +1,183 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/bcmi-labs/hydrasdk/policies"
+	"github.com/codeclysm/introspector/v3"
+)
+
+func TestIntrospect(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("active-token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		Scope:     "offline",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	server.AddToken("expired-token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		ExpiresAt: time.Now().Add(-time.Hour).Unix(),
+	})
+
+	manager, err := introspect.NewIntrospector("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i, err := manager.Introspect("active-token")
+	if err != nil {
+		t.Error(err)
+	}
+	if i.Subject != "me" {
+		t.Errorf("Expected Subject='me', got %s", i.Subject)
+	}
+
+	_, err = manager.Introspect("expired-token")
+	if err == nil {
+		t.Error("Expected an error for an expired token")
+	}
+
+	_, err = manager.Introspect("unknown-token")
+	if err == nil {
+		t.Error("Expected an error for an unknown token")
+	}
+}
+
+func TestCachedIntrospector(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("active-token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	server.AddToken("expiring-token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		ExpiresAt: time.Now().Add(time.Second).Unix(),
+	})
+
+	manager, err := introspect.NewIntrospector("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := introspect.NewCachedIntrospector(manager, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cached.Introspect("active-token"); err != nil {
+			t.Error(err)
+		}
+		if _, err := cached.Introspect("unknown-token"); err != introspector.ErrNotActive {
+			t.Errorf("Expected ErrNotActive, got %v", err)
+		}
+	}
+	if calls := server.Calls("/oauth2/introspect"); calls != 2 {
+		t.Errorf("Expected 2 calls to hydra, got %d", calls)
+	}
+
+	// The expiring token is not cached beyond its expiration
+	if _, err := cached.Introspect("expiring-token"); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if _, err := cached.Introspect("expiring-token"); err != introspector.ErrNotActive {
+		t.Errorf("Expected ErrNotActive for an expired token, got %v", err)
+	}
+	if calls := server.Calls("/oauth2/introspect"); calls != 4 {
+		t.Errorf("Expected 4 calls to hydra, got %d", calls)
+	}
+}
+
+func TestIsTokenAllowed(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("token", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		Scope:     "food",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		Extra:     map[string]interface{}{"name": "Me"},
+	})
+
+	policyManager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policyManager.Create(&policies.Policy{
+		ID:        "eat",
+		Subjects:  []string{"me"},
+		Effect:    "allow",
+		Actions:   []string{"eat"},
+		Resources: []string{"banana"},
+	})
+
+	manager, err := introspect.NewIntrospector("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := manager.IsTokenAllowed("token", "banana", "eat", []string{"food"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Subject != "me" {
+		t.Errorf("Expected Subject='me', got %s", res.Subject)
+	}
+	if len(res.Scopes) != 1 || res.Scopes[0] != "food" {
+		t.Errorf("Expected Scopes=[food], got %v", res.Scopes)
+	}
+	if res.Extra["name"] != "Me" {
+		t.Errorf("Expected the extra claims, got %v", res.Extra)
+	}
+
+	_, err = manager.IsTokenAllowed("token", "cake", "eat", []string{"food"}, nil)
+	if err != introspect.ErrTokenNotAllowed {
+		t.Errorf("Expected ErrTokenNotAllowed for a denied resource, got %v", err)
+	}
+	_, err = manager.IsTokenAllowed("token", "banana", "eat", []string{"drinks"}, nil)
+	if err != introspect.ErrTokenNotAllowed {
+		t.Errorf("Expected ErrTokenNotAllowed for a missing scope, got %v", err)
+	}
+	_, err = manager.IsTokenAllowed("unknown", "banana", "eat", nil, nil)
+	if err != introspect.ErrTokenNotAllowed {
+		t.Errorf("Expected ErrTokenNotAllowed for an unknown token, got %v", err)
+	}
+}
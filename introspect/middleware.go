@@ -0,0 +1,179 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codeclysm/introspector/v3"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Middleware validates the bearer token of the incoming requests with an Introspector,
+// answering with the errors described in https://tools.ietf.org/html/rfc6750#section-3
+//
+//	mw := introspect.Middleware{Introspector: manager, Scopes: []string{"items.read"}}
+//	http.Handle("/items", mw.Handler(items))
+type Middleware struct {
+	// Introspector validates the tokens. If it has an IntrospectCtx method,
+	// like Introspector and CachedIntrospector do, it receives the context of the request.
+	Introspector introspector.Introspector
+	// Scopes are the scopes that must all be granted to the token
+	Scopes []string
+	// Realm is reported in the WWW-Authenticate header, if not empty
+	Realm string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat of the introspection.
+	// When the Introspector is a Verifier, or wraps one, set it to the Leeway of the Verifier,
+	// otherwise the tokens it tolerates are rejected here.
+	Leeway time.Duration
+}
+
+type contextIntrospector interface {
+	IntrospectCtx(ctx context.Context, token string) (introspector.Introspection, error)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx that carries the introspection
+func NewContext(ctx context.Context, i introspector.Introspection) context.Context {
+	return context.WithValue(ctx, contextKey{}, i)
+}
+
+// FromContext returns the introspection of the token stored in ctx by the Middleware
+func FromContext(ctx context.Context) (introspector.Introspection, bool) {
+	i, ok := ctx.Value(contextKey{}).(introspector.Introspection)
+	return i, ok
+}
+
+// Handler returns a handler that calls next only if the request has an active token with
+// the required scopes. The introspection of the token can be retrieved with FromContext.
+// If the introspector fails for other reasons than an invalid token it answers with 503.
+func (m Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearer(r)
+		if !ok {
+			m.challenge(w, http.StatusUnauthorized, "", "")
+			return
+		}
+
+		var i introspector.Introspection
+		var err error
+		if ci, ok := m.Introspector.(contextIntrospector); ok {
+			i, err = ci.IntrospectCtx(r.Context(), token)
+		} else {
+			i, err = m.Introspector.Introspect(token)
+		}
+		if err == nil {
+			err = valid(i, m.Leeway)
+		}
+
+		switch errors.Cause(err) {
+		case nil:
+		case introspector.ErrNotActive, introspector.ErrExpired, introspector.ErrNotYetValid, introspector.ErrIssuedFuture:
+			m.challenge(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		default:
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		granted := strings.Fields(i.Scope)
+		for _, scope := range m.Scopes {
+			if !contains(granted, scope) {
+				m.challenge(w, http.StatusForbidden, "insufficient_scope", "token is missing the scope "+scope)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), i)))
+	})
+}
+
+// valid is like Introspection.Valid, tolerating the leeway on the times
+func valid(i introspector.Introspection, leeway time.Duration) error {
+	now := time.Now()
+	if time.Unix(i.IssuedAt, 0).After(now.Add(leeway)) {
+		return introspector.ErrIssuedFuture
+	}
+	if time.Unix(i.NotBefore, 0).After(now.Add(leeway)) {
+		return introspector.ErrNotYetValid
+	}
+	if time.Unix(i.ExpiresAt, 0).Before(now.Add(-leeway)) {
+		return introspector.ErrExpired
+	}
+	if !i.Active {
+		return introspector.ErrNotActive
+	}
+	return nil
+}
+
+// challenge writes the WWW-Authenticate header and the status code
+func (m Middleware) challenge(w http.ResponseWriter, code int, errorCode, description string) {
+	params := []string{}
+	if m.Realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", m.Realm))
+	}
+	if errorCode != "" {
+		params = append(params, fmt.Sprintf("error=%q", errorCode))
+		params = append(params, fmt.Sprintf("error_description=%q", description))
+	}
+	if errorCode == "insufficient_scope" {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(m.Scopes, " ")))
+	}
+
+	challenge := "Bearer"
+	if len(params) > 0 {
+		challenge += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, http.StatusText(code), code)
+}
+
+// bearer extracts the token from the Authorization header
+func bearer(r *http.Request) (string, bool) {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || strings.TrimSpace(parts[1]) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(parts[1]), true
+}
+
+func contains(slice []string, el string) bool {
+	for i := range slice {
+		if slice[i] == el {
+			return true
+		}
+	}
+	return false
+}
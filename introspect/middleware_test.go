@@ -0,0 +1,108 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/codeclysm/introspector/v3"
+)
+
+func TestMiddleware(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	server.AddToken("reader", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		Scope:     "items.read",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	server.AddToken("writer", introspector.Introspection{
+		Active:    true,
+		Subject:   "me",
+		Scope:     "items.read items.write",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+
+	manager, err := introspect.NewIntrospector("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw := introspect.Middleware{
+		Introspector: manager,
+		Scopes:       []string{"items.write"},
+		Realm:        "items",
+	}
+	handler := mw.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i, ok := introspect.FromContext(r.Context())
+		if !ok {
+			t.Error("Expected the introspection in the context")
+		}
+		w.Write([]byte(i.Subject))
+	}))
+
+	cases := []struct {
+		authorization string
+		code          int
+		challenge     string
+	}{
+		{"", 401, `Bearer realm="items"`},
+		{"Basic YWRtaW46ZGVtby1wYXNzd29yZA==", 401, `Bearer realm="items"`},
+		{"Bearer unknown", 401, `Bearer realm="items", error="invalid_token", error_description="token not active"`},
+		{"Bearer reader", 403, `Bearer realm="items", error="insufficient_scope", error_description="token is missing the scope items.write", scope="items.write"`},
+		{"bearer writer", 200, ""},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/items", nil)
+		if tc.authorization != "" {
+			req.Header.Set("Authorization", tc.authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.code {
+			t.Errorf("Expected %d for '%s', got %d", tc.code, tc.authorization, rec.Code)
+		}
+		if challenge := rec.Header().Get("WWW-Authenticate"); challenge != tc.challenge {
+			t.Errorf("Expected WWW-Authenticate='%s', got '%s'", tc.challenge, challenge)
+		}
+		if tc.code == 200 && rec.Body.String() != "me" {
+			t.Errorf("Expected body 'me', got '%s'", rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/keys"
+	"github.com/codeclysm/introspector/v3"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// KeyResolver retrieves a key of a set by its id. keys.CachedKeyManager implements it,
+// refreshing the set when hydra rotates the keys.
+type KeyResolver interface {
+	GetKeyCtx(ctx context.Context, set, kid string) (jose.JSONWebKey, error)
+}
+
+// Verifier validates JWT access tokens locally, with the keys of a hydra set, instead of
+// asking hydra to introspect them. It returns the same Introspection as Introspector,
+// so it can be used in its place, for example in the Middleware, with the same Leeway.
+//
+// To use the keys published at /.well-known/jwks.json, point the Endpoint of the
+// CachedKeyManager to /.well-known and use jwks.json as set.
+type Verifier struct {
+	Keys KeyResolver
+	// Set is the hydra set containing the keys that sign the tokens
+	Set string
+	// Issuer, if not empty, must match the iss claim
+	Issuer string
+	// Audience, if not empty, must be one of the aud claims
+	Audience string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat
+	Leeway time.Duration
+}
+
+// NewVerifier returns a Verifier that checks the signatures with the keys of the set,
+// with a leeway of one minute
+func NewVerifier(keys KeyResolver, set string) *Verifier {
+	return &Verifier{
+		Keys:   keys,
+		Set:    set,
+		Leeway: jwt.DefaultLeeway,
+	}
+}
+
+// accessClaims are the claims of the access tokens issued by hydra
+type accessClaims struct {
+	jwt.Claims
+	Scope    string                 `json:"scope,omitempty"`
+	Scopes   []string               `json:"scp,omitempty"`
+	ClientID string                 `json:"client_id,omitempty"`
+	Username string                 `json:"username,omitempty"`
+	Extra    map[string]interface{} `json:"ext,omitempty"`
+}
+
+// Introspect verifies the signature and the claims of the token
+func (v *Verifier) Introspect(token string) (introspector.Introspection, error) {
+	return v.IntrospectCtx(context.Background(), token)
+}
+
+// IntrospectCtx is like Introspect, but fetching the keys is bound to the given context.
+// Invalid tokens return introspector.ErrNotActive, ErrExpired, ErrNotYetValid or ErrIssuedFuture,
+// possibly wrapped, while other errors mean that the keys couldn't be retrieved.
+func (v *Verifier) IntrospectCtx(ctx context.Context, token string) (introspector.Introspection, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, "malformed token")
+	}
+	if len(parsed.Headers) != 1 || parsed.Headers[0].KeyID == "" {
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, "missing kid")
+	}
+	header := parsed.Headers[0]
+
+	key, err := v.Keys.GetKeyCtx(ctx, v.Set, header.KeyID)
+	if errors.Cause(err) == keys.ErrKeyNotFound {
+		return introspector.Introspection{}, errors.Wrapf(introspector.ErrNotActive, "unknown kid %s", header.KeyID)
+	}
+	if err != nil {
+		return introspector.Introspection{}, errors.Wrapf(err, "get key %s", header.KeyID)
+	}
+	if key.Algorithm != "" && key.Algorithm != header.Algorithm {
+		return introspector.Introspection{}, errors.Wrapf(introspector.ErrNotActive, "unexpected alg %s", header.Algorithm)
+	}
+	// Hydra returns the private key together with the public one
+	if !key.IsPublic() {
+		if public := key.Public(); public.Key != nil {
+			key = public
+		}
+	}
+
+	var claims accessClaims
+	if err := parsed.Claims(key.Key, &claims); err != nil {
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, "invalid signature")
+	}
+	if claims.Expiry == nil {
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, "missing exp")
+	}
+
+	expected := jwt.Expected{Issuer: v.Issuer, Time: time.Now()}
+	if v.Audience != "" {
+		expected.Audience = jwt.Audience{v.Audience}
+	}
+	switch err := claims.ValidateWithLeeway(expected, v.Leeway); err {
+	case nil:
+	case jwt.ErrExpired:
+		return introspector.Introspection{}, introspector.ErrExpired
+	case jwt.ErrNotValidYet:
+		return introspector.Introspection{}, introspector.ErrNotYetValid
+	case jwt.ErrIssuedInTheFuture:
+		return introspector.Introspection{}, introspector.ErrIssuedFuture
+	case jwt.ErrInvalidIssuer:
+		return introspector.Introspection{}, errors.Wrapf(introspector.ErrNotActive, "unexpected iss %s", claims.Issuer)
+	case jwt.ErrInvalidAudience:
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, "unexpected aud")
+	default:
+		return introspector.Introspection{}, errors.Wrap(introspector.ErrNotActive, err.Error())
+	}
+
+	scope := claims.Scope
+	if scope == "" {
+		scope = strings.Join(claims.Scopes, " ")
+	}
+	i := introspector.Introspection{
+		Active:    true,
+		Scope:     scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		ExpiresAt: claims.Expiry.Time().Unix(),
+		Username:  claims.Username,
+		Audience:  strings.Join(claims.Audience, " "),
+		Issuer:    claims.Issuer,
+		Extra:     claims.Extra,
+	}
+	if claims.IssuedAt != nil {
+		i.IssuedAt = claims.IssuedAt.Time().Unix()
+	}
+	if claims.NotBefore != nil {
+		i.NotBefore = claims.NotBefore.Time().Unix()
+	}
+	return i, nil
+}
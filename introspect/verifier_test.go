@@ -0,0 +1,173 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package introspect_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/introspect"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	"github.com/codeclysm/introspector/v3"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestVerifier(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("hydra.jwt.access-token", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: key, KeyID: "current", Algorithm: "RS256", Use: "sig"},
+		{Key: &key.PublicKey, KeyID: "current", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := introspect.NewVerifier(manager, "hydra.jwt.access-token")
+	verifier.Issuer = "http://hydra"
+	verifier.Audience = "items"
+
+	now := time.Now()
+	valid := jwt.Claims{
+		Issuer:   "http://hydra",
+		Subject:  "me",
+		Audience: jwt.Audience{"items", "orders"},
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(time.Hour)),
+	}
+
+	i, err := verifier.Introspect(sign(t, key, "current", valid, map[string]interface{}{"scp": []string{"items.read"}, "client_id": "app"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !i.Active || i.Subject != "me" || i.Scope != "items.read" || i.ClientID != "app" || i.Issuer != "http://hydra" {
+		t.Errorf("Unexpected introspection %+v", i)
+	}
+	if i.ExpiresAt != valid.Expiry.Time().Unix() {
+		t.Errorf("Expected exp %d, got %d", valid.Expiry.Time().Unix(), i.ExpiresAt)
+	}
+
+	skewed := valid
+	skewed.IssuedAt = jwt.NewNumericDate(now.Add(30 * time.Second))
+	if _, err := verifier.Introspect(sign(t, key, "current", skewed, nil)); err != nil {
+		t.Errorf("Expected the clock skew to be tolerated, got %s", err)
+	}
+
+	expired := valid
+	expired.Expiry = jwt.NewNumericDate(now.Add(-2 * time.Minute))
+	notYet := valid
+	notYet.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+	wrongIssuer := valid
+	wrongIssuer.Issuer = "http://evil"
+	wrongAudience := valid
+	wrongAudience.Audience = jwt.Audience{"orders"}
+	noExpiry := valid
+	noExpiry.Expiry = nil
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"expired", sign(t, key, "current", expired, nil), introspector.ErrExpired},
+		{"not yet valid", sign(t, key, "current", notYet, nil), introspector.ErrNotYetValid},
+		{"wrong issuer", sign(t, key, "current", wrongIssuer, nil), introspector.ErrNotActive},
+		{"wrong audience", sign(t, key, "current", wrongAudience, nil), introspector.ErrNotActive},
+		{"no expiry", sign(t, key, "current", noExpiry, nil), introspector.ErrNotActive},
+		{"wrong signature", sign(t, other, "current", valid, nil), introspector.ErrNotActive},
+		{"unknown kid", sign(t, other, "other", valid, nil), introspector.ErrNotActive},
+		{"malformed", "not.a.jwt", introspector.ErrNotActive},
+	}
+	for _, test := range tests {
+		_, err := verifier.Introspect(test.token)
+		if errors.Cause(err) != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+
+	// The verifier can replace the introspector in the middleware, even behind a wrapper
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlers := map[string]http.Handler{
+		"verifier": introspect.Middleware{Introspector: verifier, Leeway: verifier.Leeway}.Handler(ok),
+		"wrapper":  introspect.Middleware{Introspector: wrapper{verifier}, Leeway: verifier.Leeway}.Handler(ok),
+	}
+	for name, handler := range handlers {
+		for token, code := range map[string]int{
+			sign(t, key, "current", skewed, nil):  http.StatusOK,
+			sign(t, key, "current", expired, nil): http.StatusUnauthorized,
+		} {
+			req := httptest.NewRequest("GET", "/items", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != code {
+				t.Errorf("%s: expected %d, got %d", name, code, rec.Code)
+			}
+		}
+	}
+}
+
+func sign(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.Claims, extra map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key}, (&jose.SignerOptions{}).WithHeader("kid", kid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := jwt.Signed(signer).Claims(claims)
+	if extra != nil {
+		builder = builder.Claims(extra)
+	}
+	token, err := builder.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// wrapper hides the methods of the Introspector other than Introspect, like a decorator would
+type wrapper struct {
+	introspector.Introspector
+}
@@ -0,0 +1,227 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// cachedSet is a set retrieved from hydra, with the keys that a refresh removed from it
+type cachedSet struct {
+	keys    jose.JSONWebKeySet
+	fetched time.Time
+	retired []retiredKey
+}
+
+type retiredKey struct {
+	key   jose.JSONWebKey
+	until time.Time
+}
+
+// Start refreshes the cached sets every RefreshInterval in the background, until Stop is called.
+// It does nothing if RefreshInterval is zero or if it's already started.
+func (m *CachedKeyManager) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.RefreshInterval <= 0 || m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+
+	go func(stop chan struct{}, interval time.Duration) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for _, set := range m.cachedSets() {
+					// On failure the stale keys are kept, and the next tick tries again
+					m.refresh(context.Background(), set)
+				}
+			}
+		}
+	}(m.stop, m.RefreshInterval)
+}
+
+// Stop ends the background refresh started by Start
+func (m *CachedKeyManager) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+}
+
+// getSet returns the cached set, fetching it if it's missing or older than RefreshInterval.
+// If the refresh of a stale set fails the stale keys are returned.
+func (m *CachedKeyManager) getSet(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	m.mu.RLock()
+	cached, ok := m.sets[set]
+	m.mu.RUnlock()
+
+	if ok && (m.RefreshInterval <= 0 || time.Since(cached.fetched) < m.RefreshInterval) {
+		return cached.keys, nil
+	}
+
+	keyset, err := m.refresh(ctx, set)
+	if err != nil {
+		if ok {
+			return cached.keys, nil
+		}
+		return jose.JSONWebKeySet{}, err
+	}
+	return keyset, nil
+}
+
+// refreshIfOlder fetches the set again only if it was fetched more than age ago
+func (m *CachedKeyManager) refreshIfOlder(ctx context.Context, set string, age time.Duration) (bool, error) {
+	m.mu.RLock()
+	cached, ok := m.sets[set]
+	m.mu.RUnlock()
+
+	if ok && time.Since(cached.fetched) < age {
+		return false, nil
+	}
+
+	_, err := m.refresh(ctx, set)
+	return err == nil, err
+}
+
+// refresh fetches the set and replaces the cached one. Concurrent refreshes of the same set
+// are merged into a single request, bounded by FetchTimeout instead of the context of a caller.
+func (m *CachedKeyManager) refresh(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	keyset, err := m.flights.Do(ctx, set, m.FetchTimeout, func(ctx context.Context) (interface{}, error) {
+		return m.update(ctx, set)
+	})
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+	return keyset.(jose.JSONWebKeySet), nil
+}
+
+// update fetches the set and replaces the cached one. The keys that are not in the set
+// anymore are kept for GracePeriod.
+func (m *CachedKeyManager) update(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	keyset, err := m.fetch(ctx, set)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.sets == nil {
+		m.sets = map[string]*cachedSet{}
+	}
+
+	refreshed := &cachedSet{keys: keyset, fetched: now}
+	if old, ok := m.sets[set]; ok {
+		for _, r := range old.retired {
+			if r.until.After(now) && len(keyset.Key(r.key.KeyID)) == 0 {
+				refreshed.retired = append(refreshed.retired, r)
+			}
+		}
+		for _, key := range old.keys.Keys {
+			if len(keyset.Key(key.KeyID)) == 0 && m.GracePeriod > 0 {
+				refreshed.retired = append(refreshed.retired, retiredKey{key: key, until: now.Add(m.GracePeriod)})
+			}
+		}
+	}
+	m.sets[set] = refreshed
+
+	return keyset, nil
+}
+
+// lookup searches the key in the cached set, including the retired keys still in their grace period.
+// If match is not nil, only the keys it accepts are considered.
+func (m *CachedKeyManager) lookup(set, kid string, match func(jose.JSONWebKey) bool) (jose.JSONWebKey, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	cached, ok := m.sets[set]
+	if !ok {
+		return jose.JSONWebKey{}, false
+	}
+	for _, key := range cached.keys.Key(kid) {
+		if match == nil || match(key) {
+			return key, true
+		}
+	}
+	for _, r := range cached.retired {
+		if r.key.KeyID == kid && time.Now().Before(r.until) && (match == nil || match(r.key)) {
+			return r.key, true
+		}
+	}
+	return jose.JSONWebKey{}, false
+}
+
+// cachedSets returns the names of the sets in cache
+func (m *CachedKeyManager) cachedSets() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sets := make([]string, 0, len(m.sets))
+	for set := range m.sets {
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// fetch retrieves the set from hydra
+func (m *CachedKeyManager) fetch(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	url := common.JoinURL(m.Endpoint, set).String()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	var keyset jose.JSONWebKeySet
+	err = common.Bind(m.Client, req, &keyset)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+	return keyset, nil
+}
@@ -0,0 +1,189 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// GetPublic retrieves the first public key of the given set, whatever its type, or the
+// public half of its first private key. It's an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey
+func (m *CachedKeyManager) GetPublic(set string) (crypto.PublicKey, error) {
+	return m.GetPublicCtx(context.Background(), set)
+}
+
+// GetPublicCtx is like GetPublic, but the request is bound to the given context
+func (m *CachedKeyManager) GetPublicCtx(ctx context.Context, set string) (crypto.PublicKey, error) {
+	return m.public(ctx, set, "asymmetric", func(crypto.PublicKey) bool { return true })
+}
+
+// GetSigner retrieves the first private key of the given set, whatever its type.
+// It's an *rsa.PrivateKey, an *ecdsa.PrivateKey or an ed25519.PrivateKey
+func (m *CachedKeyManager) GetSigner(set string) (crypto.Signer, error) {
+	return m.GetSignerCtx(context.Background(), set)
+}
+
+// GetSignerCtx is like GetSigner, but the request is bound to the given context
+func (m *CachedKeyManager) GetSignerCtx(ctx context.Context, set string) (crypto.Signer, error) {
+	return m.private(ctx, set, "asymmetric", func(crypto.Signer) bool { return true })
+}
+
+// GetECDSAPublic retrieves the first ECDSA public key of the given set, or the public half of its first
+// ECDSA private key
+func (m *CachedKeyManager) GetECDSAPublic(set string) (*ecdsa.PublicKey, error) {
+	return m.GetECDSAPublicCtx(context.Background(), set)
+}
+
+// GetECDSAPublicCtx is like GetECDSAPublic, but the request is bound to the given context
+func (m *CachedKeyManager) GetECDSAPublicCtx(ctx context.Context, set string) (*ecdsa.PublicKey, error) {
+	key, err := m.public(ctx, set, "ECDSA", func(key crypto.PublicKey) bool {
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(*ecdsa.PublicKey), nil
+}
+
+// GetECDSAPrivate retrieves the first ECDSA private key of the given set
+func (m *CachedKeyManager) GetECDSAPrivate(set string) (*ecdsa.PrivateKey, error) {
+	return m.GetECDSAPrivateCtx(context.Background(), set)
+}
+
+// GetECDSAPrivateCtx is like GetECDSAPrivate, but the request is bound to the given context
+func (m *CachedKeyManager) GetECDSAPrivateCtx(ctx context.Context, set string) (*ecdsa.PrivateKey, error) {
+	key, err := m.private(ctx, set, "ECDSA", func(key crypto.Signer) bool {
+		_, ok := key.(*ecdsa.PrivateKey)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(*ecdsa.PrivateKey), nil
+}
+
+// GetEd25519Public retrieves the first Ed25519 public key of the given set, or the public half of its first
+// Ed25519 private key
+func (m *CachedKeyManager) GetEd25519Public(set string) (ed25519.PublicKey, error) {
+	return m.GetEd25519PublicCtx(context.Background(), set)
+}
+
+// GetEd25519PublicCtx is like GetEd25519Public, but the request is bound to the given context
+func (m *CachedKeyManager) GetEd25519PublicCtx(ctx context.Context, set string) (ed25519.PublicKey, error) {
+	key, err := m.public(ctx, set, "Ed25519", func(key crypto.PublicKey) bool {
+		_, ok := key.(ed25519.PublicKey)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(ed25519.PublicKey), nil
+}
+
+// GetEd25519Private retrieves the first Ed25519 private key of the given set
+func (m *CachedKeyManager) GetEd25519Private(set string) (ed25519.PrivateKey, error) {
+	return m.GetEd25519PrivateCtx(context.Background(), set)
+}
+
+// GetEd25519PrivateCtx is like GetEd25519Private, but the request is bound to the given context
+func (m *CachedKeyManager) GetEd25519PrivateCtx(ctx context.Context, set string) (ed25519.PrivateKey, error) {
+	key, err := m.private(ctx, set, "Ed25519", func(key crypto.Signer) bool {
+		_, ok := key.(ed25519.PrivateKey)
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key.(ed25519.PrivateKey), nil
+}
+
+// public returns the first public key of the set accepted by match, falling back to the
+// public half of the first private key accepted. kind is only used in the error message
+func (m *CachedKeyManager) public(ctx context.Context, set, kind string, match func(crypto.PublicKey) bool) (crypto.PublicKey, error) {
+	keyset, err := m.getSet(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyset.Keys) == 0 {
+		return nil, errors.New("The retrieved keyset is empty")
+	}
+
+	for _, key := range keyset.Keys {
+		if isAsymmetric(key) && key.IsPublic() && match(key.Key) {
+			return key.Key, nil
+		}
+	}
+	for _, key := range keyset.Keys {
+		if !isAsymmetric(key) || key.IsPublic() {
+			continue
+		}
+		if public := key.Public(); public.Key != nil && match(public.Key) {
+			return public.Key, nil
+		}
+	}
+	return nil, errors.Errorf("No %s public key in set %s", kind, set)
+}
+
+// private returns the first private key of the set accepted by match.
+// kind is only used in the error message
+func (m *CachedKeyManager) private(ctx context.Context, set, kind string, match func(crypto.Signer) bool) (crypto.Signer, error) {
+	keyset, err := m.getSet(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyset.Keys) == 0 {
+		return nil, errors.New("The retrieved keyset is empty")
+	}
+
+	for _, key := range keyset.Keys {
+		if !isAsymmetric(key) || key.IsPublic() {
+			continue
+		}
+		if signer, ok := key.Key.(crypto.Signer); ok && match(signer) {
+			return signer, nil
+		}
+	}
+	return nil, errors.Errorf("No %s private key in set %s", kind, set)
+}
+
+// isAsymmetric tells if the key is a public or private key, rather than a symmetric secret
+func isAsymmetric(key jose.JSONWebKey) bool {
+	_, symmetric := key.Key.([]byte)
+	return key.Key != nil && !symmetric
+}
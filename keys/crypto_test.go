@@ -0,0 +1,192 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestGetEC(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("ec", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: key, KeyID: "private", Algorithm: "ES256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := manager.GetECDSAPublic("ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.X.Cmp(key.X) != 0 || public.Y.Cmp(key.Y) != 0 {
+		t.Error("Expected the public key to match")
+	}
+	private, err := manager.GetECDSAPrivate("ec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private.D.Cmp(key.D) != 0 {
+		t.Error("Expected the private key to match")
+	}
+
+	if _, err := manager.GetRSAPublic("ec"); err == nil {
+		t.Error("Expected an error asking an RSA key from an EC set")
+	}
+	if _, err := manager.GetEd25519Private("ec"); err == nil {
+		t.Error("Expected an error asking an Ed25519 key from an EC set")
+	}
+}
+
+func TestGetEd25519(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("ed", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: private, KeyID: "private", Algorithm: "EdDSA", Use: "sig"},
+		{Key: public, KeyID: "public", Algorithm: "EdDSA", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotPublic, err := manager.GetEd25519Public("ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotPublic) != string(public) {
+		t.Error("Expected the public key to match")
+	}
+	gotPrivate, err := manager.GetEd25519Private("ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(gotPrivate) != string(private) {
+		t.Error("Expected the private key to match")
+	}
+
+	if _, err := manager.GetECDSAPublic("ed"); err == nil {
+		t.Error("Expected an error asking an ECDSA key from an Ed25519 set")
+	}
+}
+
+func TestGetSigner(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		set string
+		key crypto.Signer
+	}{
+		{"rsa", rsaKey},
+		{"ec", ecKey},
+		{"ed", edKey},
+	}
+
+	for _, test := range tests {
+		server.AddKeySet(test.set, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: []byte("secret"), KeyID: "symmetric", Algorithm: "HS256", Use: "sig"},
+			{Key: test.key, KeyID: test.set, Use: "sig"},
+		}})
+	}
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range tests {
+		signer, err := manager.GetSigner(test.set)
+		if err != nil {
+			t.Errorf("%s: %s", test.set, err)
+			continue
+		}
+		public, err := manager.GetPublic(test.set)
+		if err != nil {
+			t.Errorf("%s: %s", test.set, err)
+			continue
+		}
+
+		// Compare the public keys through their thumbprints, since the types differ
+		expected := thumbprint(t, test.key.Public())
+		if thumbprint(t, signer.Public()) != expected {
+			t.Errorf("%s: Expected the signer to match", test.set)
+		}
+		if thumbprint(t, public) != expected {
+			t.Errorf("%s: Expected the public key to match", test.set)
+		}
+	}
+}
+
+func thumbprint(t *testing.T, key crypto.PublicKey) string {
+	jwk := jose.JSONWebKey{Key: key}
+	sum, err := jwk.Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(sum)
+}
@@ -0,0 +1,146 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// Encrypt returns the compact serialization of a JWE of the payload, encrypted with
+// A256GCM to the first public key of the set intended for encryption (use enc).
+// RSA keys use RSA-OAEP-256 and EC keys use ECDH-ES. The kid of the key is set in the header,
+// so that the recipient can pick the private key to decrypt it.
+func (m *CachedKeyManager) Encrypt(set string, payload []byte) (string, error) {
+	return m.EncryptCtx(context.Background(), set, payload)
+}
+
+// EncryptCtx is like Encrypt, but retrieving the key is bound to the given context
+func (m *CachedKeyManager) EncryptCtx(ctx context.Context, set string, payload []byte) (string, error) {
+	keyset, err := m.getSet(ctx, set)
+	if err != nil {
+		return "", err
+	}
+
+	// The public keys are preferred, but hydra may return only the private ones
+	candidates := []jose.JSONWebKey{}
+	for _, key := range keyset.Keys {
+		if key.Use == "enc" && key.IsPublic() {
+			candidates = append(candidates, key)
+		}
+	}
+	for _, key := range keyset.Keys {
+		if key.Use == "enc" && isAsymmetric(key) && !key.IsPublic() {
+			candidates = append(candidates, key.Public())
+		}
+	}
+
+	for _, key := range candidates {
+		alg, ok := keyAlgorithm(key)
+		if !ok {
+			continue
+		}
+
+		recipient := jose.Recipient{Algorithm: alg, Key: key.Key, KeyID: key.KeyID}
+		encrypter, err := jose.NewEncrypter(jose.A256GCM, recipient, nil)
+		if err != nil {
+			return "", errors.Wrapf(err, "new encrypter with key %s", key.KeyID)
+		}
+		jwe, err := encrypter.Encrypt(payload)
+		if err != nil {
+			return "", errors.Wrapf(err, "encrypt with key %s", key.KeyID)
+		}
+		return jwe.CompactSerialize()
+	}
+	return "", errors.Errorf("No encryption key in set %s", set)
+}
+
+// Decrypt decrypts the compact serialization of a JWE with the private key of the set
+// matching the kid in its header. Like GetKey, it fetches the set again if the key is unknown.
+// The JWE must use the algorithm of the key, the same that Encrypt would choose.
+func (m *CachedKeyManager) Decrypt(set, jwe string) ([]byte, error) {
+	return m.DecryptCtx(context.Background(), set, jwe)
+}
+
+// DecryptCtx is like Decrypt, but retrieving the key is bound to the given context
+func (m *CachedKeyManager) DecryptCtx(ctx context.Context, set, jwe string) ([]byte, error) {
+	object, err := jose.ParseEncrypted(jwe)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse jwe")
+	}
+	kid := object.Header.KeyID
+	if kid == "" {
+		return nil, errors.New("The jwe has no kid")
+	}
+
+	key, err := m.getKey(ctx, set, kid, func(key jose.JSONWebKey) bool {
+		return key.Use == "enc" && isAsymmetric(key) && !key.IsPublic()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the algorithm of the key is accepted, so that the sender can't downgrade it, to RSA1_5 for example
+	alg, ok := keyAlgorithm(key.Public())
+	if !ok {
+		return nil, errors.Errorf("The key %s can't be used to decrypt", kid)
+	}
+	if object.Header.Algorithm != string(alg) {
+		return nil, errors.Errorf("The jwe uses %s, but the key %s requires %s", object.Header.Algorithm, kid, alg)
+	}
+
+	payload, err := object.Decrypt(key.Key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "decrypt with key %s", kid)
+	}
+	return payload, nil
+}
+
+// keyAlgorithm returns the key management algorithm used to encrypt to the public key.
+// It's false if the key is of another type, or if it declares a different algorithm.
+func keyAlgorithm(key jose.JSONWebKey) (jose.KeyAlgorithm, bool) {
+	var alg jose.KeyAlgorithm
+	switch key.Key.(type) {
+	case *rsa.PublicKey:
+		alg = jose.RSA_OAEP_256
+	case *ecdsa.PublicKey:
+		alg = jose.ECDH_ES
+	default:
+		return "", false
+	}
+	if key.Algorithm != "" && key.Algorithm != string(alg) {
+		return "", false
+	}
+	return alg, true
+}
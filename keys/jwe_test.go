@@ -0,0 +1,130 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []string{"RSA-OAEP-256", "ECDH-ES"} {
+		// The signing key must be ignored
+		if _, err := manager.Create(alg, "ES256", "signing", "sig"); err != nil {
+			t.Fatal(err)
+		}
+		created, err := manager.Create(alg, alg, "", "enc")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		jwe, err := cached.Encrypt(alg, []byte("secret payload"))
+		if err != nil {
+			t.Errorf("%s: %s", alg, err)
+			continue
+		}
+
+		object, err := jose.ParseEncrypted(jwe)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if object.Header.KeyID != created.Keys[0].KeyID || object.Header.Algorithm != alg {
+			t.Errorf("%s: Unexpected header %s %s", alg, object.Header.KeyID, object.Header.Algorithm)
+		}
+
+		payload, err := cached.Decrypt(alg, jwe)
+		if err != nil {
+			t.Errorf("%s: %s", alg, err)
+		}
+		if string(payload) != "secret payload" {
+			t.Errorf("%s: Expected the payload, got %s", alg, payload)
+		}
+	}
+
+	// A jwe encrypted to another set can't be decrypted
+	jwe, err := cached.Encrypt("RSA-OAEP-256", []byte("secret payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Decrypt("ECDH-ES", jwe); errors.Cause(err) != keys.ErrKeyNotFound {
+		t.Errorf("Expected a key not found error, got %v", err)
+	}
+
+	// The sender can't choose a weaker algorithm than the one of the key
+	keyset, err := cached.GetSet("RSA-OAEP-256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var public jose.JSONWebKey
+	for _, key := range keyset.Keys {
+		if key.Use == "enc" && key.IsPublic() {
+			public = key
+		}
+	}
+	recipient := jose.Recipient{Algorithm: jose.RSA1_5, Key: public.Key, KeyID: public.KeyID}
+	encrypter, err := jose.NewEncrypter(jose.A256GCM, recipient, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object, err := encrypter.Encrypt([]byte("secret payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, err := object.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Decrypt("RSA-OAEP-256", downgraded); err == nil {
+		t.Error("Expected an error decrypting a jwe using RSA1_5")
+	}
+
+	if _, err := manager.Create("signing-only", "ES256", "", "sig"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.Encrypt("signing-only", []byte("secret payload")); err == nil {
+		t.Error("Expected an error without encryption keys")
+	}
+}
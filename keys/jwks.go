@@ -0,0 +1,151 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// JWKSHandler is an http.Handler that publishes the public keys of some hydra sets
+// as a single json web key set. Private and symmetric keys are never served.
+// The keys come from the cache of the manager: set its RefreshInterval and Start it
+// to publish the keys rotated by hydra.
+//
+//	http.Handle("/.well-known/jwks.json", keys.NewJWKSHandler(manager, "hydra.openid.id-token"))
+type JWKSHandler struct {
+	Keys *CachedKeyManager
+	Sets []string
+	// MaxAge is sent in the Cache-Control header
+	MaxAge time.Duration
+}
+
+// NewJWKSHandler returns a JWKSHandler serving the public keys of the sets,
+// that can be cached by the clients for five minutes
+func NewJWKSHandler(manager *CachedKeyManager, sets ...string) *JWKSHandler {
+	return &JWKSHandler{
+		Keys:   manager,
+		Sets:   sets,
+		MaxAge: 5 * time.Minute,
+	}
+}
+
+// ServeHTTP answers to GET and HEAD requests with the json web key set. It supports
+// conditional requests with If-None-Match, and answers with 503 if a set can't be retrieved.
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	keyset := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	for _, set := range h.Sets {
+		current, err := h.Keys.GetSetCtx(r.Context(), set)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		keyset.Keys = append(keyset.Keys, current.Keys...)
+	}
+
+	body, err := json.Marshal(publicKeys(keyset))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(h.MaxAge.Seconds())))
+	if matches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "GET" {
+		w.Write(body)
+	}
+}
+
+// publicKeys returns the public keys of the set, and the public halves of the private ones.
+// A key is served only once, even if hydra returns it both as private and as public, while
+// different keys are all served even if they share a kid, since they come from different sets.
+func publicKeys(keyset jose.JSONWebKeySet) jose.JSONWebKeySet {
+	public := jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	thumbprints := map[string]bool{}
+
+	add := func(key jose.JSONWebKey) {
+		thumbprint, err := key.Thumbprint(crypto.SHA256)
+		if err != nil || thumbprints[string(thumbprint)] {
+			return
+		}
+		thumbprints[string(thumbprint)] = true
+		public.Keys = append(public.Keys, key)
+	}
+
+	for _, key := range keyset.Keys {
+		if isAsymmetric(key) && key.IsPublic() {
+			add(key)
+		}
+	}
+	for _, key := range keyset.Keys {
+		if !isAsymmetric(key) || key.IsPublic() {
+			continue
+		}
+		if half := key.Public(); half.Key != nil {
+			add(half)
+		}
+	}
+	return public
+}
+
+// matches tells if the If-None-Match header contains the etag
+func matches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
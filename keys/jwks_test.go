@@ -0,0 +1,169 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("id-token", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: first, KeyID: "first", Algorithm: "ES256", Use: "sig"},
+		{Key: &first.PublicKey, KeyID: "first", Algorithm: "ES256", Use: "sig"},
+		{Key: []byte("secret"), KeyID: "symmetric", Algorithm: "HS256", Use: "sig"},
+	}})
+	server.AddKeySet("access-token", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: second, KeyID: "second", Algorithm: "ES256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := keys.NewJWKSHandler(manager, "id-token", "access-token")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	if rec.Header().Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("Unexpected Cache-Control %s", rec.Header().Get("Cache-Control"))
+	}
+
+	var keyset jose.JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &keyset); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyset.Keys) != 2 {
+		t.Fatalf("Expected 2 public keys, got %d", len(keyset.Keys))
+	}
+	for _, key := range keyset.Keys {
+		if !key.IsPublic() {
+			t.Errorf("Expected %s to be public", key.KeyID)
+		}
+	}
+	if len(keyset.Key("first")) != 1 || len(keyset.Key("second")) != 1 {
+		t.Error("Expected a key from each set")
+	}
+
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Expected 304 without body, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+
+	missing := keys.NewJWKSHandler(manager, "missing")
+	rec = httptest.NewRecorder()
+	missing.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", rec.Code)
+	}
+}
+
+func TestJWKSHandlerSharedKid(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Different keys with the same kid in different sets are both served
+	server.AddKeySet("id-token", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: first, KeyID: "default", Algorithm: "ES256", Use: "sig"},
+	}})
+	server.AddKeySet("access-token", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: second, KeyID: "default", Algorithm: "ES256", Use: "sig"},
+		{Key: &second.PublicKey, KeyID: "default", Algorithm: "ES256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	keys.NewJWKSHandler(manager, "id-token", "access-token").ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var keyset jose.JSONWebKeySet
+	if err := json.Unmarshal(rec.Body.Bytes(), &keyset); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyset.Keys) != 2 {
+		t.Fatalf("Expected both keys, got %d", len(keyset.Keys))
+	}
+	want := map[string]bool{thumbprint(t, &first.PublicKey): true, thumbprint(t, &second.PublicKey): true}
+	for _, key := range keyset.Keys {
+		if !want[thumbprint(t, key.Key)] {
+			t.Errorf("Unexpected key %s", key.KeyID)
+		}
+	}
+}
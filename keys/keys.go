@@ -30,114 +30,206 @@
 package keys
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"net/http"
 	"net/url"
+	"sync"
+	"time"
 
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 	jose "gopkg.in/square/go-jose.v2"
 )
 
+// ErrKeyNotFound is returned by GetKey when the set doesn't contain the key, even after a refresh
+var ErrKeyNotFound = errors.New("key not found")
+
 // KeyGetter provides functions to retrieve a key from an hydra set (tipically the first)
 type KeyGetter interface {
 	GetRSAPublic(set string) (*rsa.PublicKey, error)
 	GetRSAPrivate(set string) (*rsa.PrivateKey, error)
 }
 
-// CachedKeyManager uses hydra rest api to retrieve keys and cache them for easy access
-type CachedKeyManager struct {
-	Endpoint *url.URL
-	Client   *http.Client
+// SignerGetter provides functions to retrieve a key of any type from an hydra set
+type SignerGetter interface {
+	GetPublic(set string) (crypto.PublicKey, error)
+	GetSigner(set string) (crypto.Signer, error)
+}
 
-	rsaPublics  map[string]*rsa.PublicKey
-	rsaPrivates map[string]*rsa.PrivateKey
+// defaultMinRefreshInterval limits the fetches caused by unknown key ids when
+// MinRefreshInterval is not set, so that they can't be used to flood hydra
+const defaultMinRefreshInterval = 10 * time.Second
+
+// CachedKeyManager uses hydra rest api to retrieve keys and cache them for easy access.
+// By default the sets are cached forever: set RefreshInterval and call Start to keep them
+// up to date when hydra rotates the keys.
+// It's safe for concurrent use, and concurrent fetches of the same set are merged into one.
+type CachedKeyManager struct {
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	Client         *http.Client
+
+	// RefreshInterval is how often the cached sets are fetched again. Zero means never.
+	RefreshInterval time.Duration
+	// GracePeriod is how long the keys removed from a set are still returned by GetKey
+	GracePeriod time.Duration
+	// MinRefreshInterval is the minimum time between two fetches of a set caused by
+	// GetKey asking for an unknown key id. The constructors set it to 10 seconds, and zero,
+	// as in a CachedKeyManager built as a struct literal, means 10 seconds too.
+	MinRefreshInterval time.Duration
+	// FetchTimeout bounds each fetch of a set. The fetch is shared by the concurrent callers,
+	// so it doesn't follow the deadline of any of them. Zero means 30 seconds.
+	FetchTimeout time.Duration
+
+	mu   sync.RWMutex
+	sets map[string]*cachedSet
+	stop chan struct{}
+
+	flights common.Flight
 }
 
 // NewCachedKeyManager returns a CachedKeyManager connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewCachedKeyManager(id, secret, cluster string) (*CachedKeyManager, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewCachedKeyManagerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewCachedKeyManagerWithOptions returns a CachedKeyManager connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewCachedKeyManagerWithOptions(cluster string, opts ...common.Option) (*CachedKeyManager, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate ClientManager")
 	}
 	manager := CachedKeyManager{
-		Endpoint:    common.JoinURL(endpoint, "keys"),
-		Client:      client,
-		rsaPublics:  map[string]*rsa.PublicKey{},
-		rsaPrivates: map[string]*rsa.PrivateKey{},
+		Endpoint:           common.JoinURL(endpoint, "keys"),
+		HealthEndpoint:     common.JoinURL(endpoint, "health", "status"),
+		Client:             client,
+		GracePeriod:        time.Hour,
+		MinRefreshInterval: defaultMinRefreshInterval,
+		sets:               map[string]*cachedSet{},
 	}
 	return &manager, nil
 }
 
-// GetRSAPublic retrieves the first key of the given set. It caches them forever,
-// so hope that they don't change
-func (m CachedKeyManager) GetRSAPublic(set string) (*rsa.PublicKey, error) {
-	// Try getting from cache
-	if key, ok := m.rsaPublics[set]; ok {
-		return key, nil
-	}
-
-	url := common.JoinURL(m.Endpoint, set).String()
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *CachedKeyManager) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "new request for %s", url)
-	}
+// GetRSAPublic retrieves the first RSA public key of the given set, or the public half of its first
+// RSA private key. It caches the set, refreshing it every RefreshInterval if set
+func (m *CachedKeyManager) GetRSAPublic(set string) (*rsa.PublicKey, error) {
+	return m.GetRSAPublicCtx(context.Background(), set)
+}
 
-	var keyset jose.JSONWebKeySet
-	err = common.Bind(m.Client, req, &keyset)
+// GetRSAPublicCtx is like GetRSAPublic, but the request is bound to the given context
+func (m *CachedKeyManager) GetRSAPublicCtx(ctx context.Context, set string) (*rsa.PublicKey, error) {
+	key, err := m.public(ctx, set, "RSA", func(key crypto.PublicKey) bool {
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	})
 	if err != nil {
 		return nil, err
 	}
+	return key.(*rsa.PublicKey), nil
+}
 
-	if len(keyset.Keys) == 0 {
-		return nil, errors.New("The retrieved keyset is empty")
-	}
+// GetRSAPrivate retrieves the first RSA private key of the given set. It caches the set,
+// refreshing it every RefreshInterval if set
+func (m *CachedKeyManager) GetRSAPrivate(set string) (*rsa.PrivateKey, error) {
+	return m.GetRSAPrivateCtx(context.Background(), set)
+}
 
-	key, ok := keyset.Keys[0].Key.(*rsa.PublicKey)
-	if !ok {
-		return key, errors.New("Could not convert key to RSA Private Key.")
+// GetRSAPrivateCtx is like GetRSAPrivate, but the request is bound to the given context
+func (m *CachedKeyManager) GetRSAPrivateCtx(ctx context.Context, set string) (*rsa.PrivateKey, error) {
+	key, err := m.private(ctx, set, "RSA", func(key crypto.Signer) bool {
+		_, ok := key.(*rsa.PrivateKey)
+		return ok
+	})
+	if err != nil {
+		return nil, err
 	}
+	return key.(*rsa.PrivateKey), nil
+}
 
-	// Save on cache
-	m.rsaPublics[set] = key
-
-	return key, nil
+// GetSet retrieves all the keys of the given set, with their metadata
+func (m *CachedKeyManager) GetSet(set string) (jose.JSONWebKeySet, error) {
+	return m.GetSetCtx(context.Background(), set)
 }
 
-// GetRSAPrivate retrieves the first key of the given set. It caches them forever,
-// so hope that they don't change
-func (m CachedKeyManager) GetRSAPrivate(set string) (*rsa.PrivateKey, error) {
-	// Try getting from cache
-	if key, ok := m.rsaPrivates[set]; ok {
-		return key, nil
+// GetSetCtx is like GetSet, but the request is bound to the given context
+func (m *CachedKeyManager) GetSetCtx(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	keyset, err := m.getSet(ctx, set)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
 	}
 
-	url := common.JoinURL(m.Endpoint, set).String()
+	// Copy the keys, so that the cache can't be modified
+	keys := make([]jose.JSONWebKey, len(keyset.Keys))
+	copy(keys, keyset.Keys)
+	return jose.JSONWebKeySet{Keys: keys}, nil
+}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, errors.Wrapf(err, "new request for %s", url)
-	}
+// GetKeysByUse retrieves the keys of the given set intended for the given use, sig or enc
+func (m *CachedKeyManager) GetKeysByUse(set, use string) ([]jose.JSONWebKey, error) {
+	return m.GetKeysByUseCtx(context.Background(), set, use)
+}
 
-	var keyset jose.JSONWebKeySet
-	err = common.Bind(m.Client, req, &keyset)
+// GetKeysByUseCtx is like GetKeysByUse, but the request is bound to the given context
+func (m *CachedKeyManager) GetKeysByUseCtx(ctx context.Context, set, use string) ([]jose.JSONWebKey, error) {
+	keyset, err := m.getSet(ctx, set)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(keyset.Keys) == 0 {
-		return nil, errors.New("The retrieved keyset is empty")
+	keys := []jose.JSONWebKey{}
+	for _, key := range keyset.Keys {
+		if key.Use == use {
+			keys = append(keys, key)
+		}
 	}
+	return keys, nil
+}
 
-	key, ok := keyset.Keys[0].Key.(*rsa.PrivateKey)
-	if !ok {
-		return key, errors.New("Could not convert key to RSA Private Key.")
+// GetKey retrieves the key with the given id from the set. If the key is unknown the set
+// is fetched again, since hydra may have rotated it, and the keys removed by a rotation
+// are still returned for GracePeriod.
+func (m *CachedKeyManager) GetKey(set, kid string) (jose.JSONWebKey, error) {
+	return m.GetKeyCtx(context.Background(), set, kid)
+}
+
+// GetKeyCtx is like GetKey, but the request is bound to the given context
+func (m *CachedKeyManager) GetKeyCtx(ctx context.Context, set, kid string) (jose.JSONWebKey, error) {
+	return m.getKey(ctx, set, kid, nil)
+}
+
+// getKey searches the key in the set, refreshing it if the key is missing.
+// If match is not nil, only the keys it accepts are considered.
+func (m *CachedKeyManager) getKey(ctx context.Context, set, kid string, match func(jose.JSONWebKey) bool) (jose.JSONWebKey, error) {
+	if _, err := m.getSet(ctx, set); err != nil {
+		return jose.JSONWebKey{}, err
 	}
 
-	// Save on cache
-	m.rsaPrivates[set] = key
+	if key, ok := m.lookup(set, kid, match); ok {
+		return key, nil
+	}
 
-	return key, nil
+	// MinRefreshInterval is zero only in a struct literal, which must be limited anyway
+	interval := m.MinRefreshInterval
+	if interval <= 0 {
+		interval = defaultMinRefreshInterval
+	}
+	refreshed, err := m.refreshIfOlder(ctx, set, interval)
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+	if refreshed {
+		if key, ok := m.lookup(set, kid, match); ok {
+			return key, nil
+		}
+	}
+	return jose.JSONWebKey{}, errors.Wrapf(ErrKeyNotFound, "%s in set %s", kid, set)
 }
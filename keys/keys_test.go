@@ -0,0 +1,411 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestGetRSA(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("public", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: "public", Algorithm: "RS256", Use: "sig"},
+	}})
+	server.AddKeySet("private", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: key, KeyID: "private", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := manager.GetRSAPublic("public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.N.Cmp(key.N) != 0 {
+		t.Error("Expected the public key to match")
+	}
+
+	private, err := manager.GetRSAPrivate("private")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private.D.Cmp(key.D) != 0 {
+		t.Error("Expected the private key to match")
+	}
+
+	_, err = manager.GetRSAPublic("missing")
+	if err == nil {
+		t.Error("Expected an error for a missing set")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key := func(kid string) jose.JSONWebKey {
+		k, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return jose.JSONWebKey{Key: &k.PublicKey, KeyID: kid, Algorithm: "RS256", Use: "sig"}
+	}
+	first, second, third := key("first"), key("second"), key("third")
+
+	server.AddKeySet("rotating", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{first}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.GracePeriod = 200 * time.Millisecond
+	manager.MinRefreshInterval = time.Nanosecond
+
+	if _, err := manager.GetKey("rotating", "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown kid causes a refresh, and the old key is kept during the grace period
+	server.AddKeySet("rotating", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{second}})
+	if _, err := manager.GetKey("rotating", "second"); err != nil {
+		t.Error(err)
+	}
+	if _, err := manager.GetKey("rotating", "first"); err != nil {
+		t.Errorf("Expected the rotated key to be kept during the grace period, got %s", err)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if _, err := manager.GetKey("rotating", "first"); err == nil {
+		t.Error("Expected the rotated key to be removed after the grace period")
+	}
+
+	// The background refresh picks up the new keys
+	server.AddKeySet("rotating", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{third}})
+
+	calls := server.Calls("/keys/rotating")
+	manager.RefreshInterval = 50 * time.Millisecond
+	manager.Start()
+	defer manager.Stop()
+	time.Sleep(175 * time.Millisecond)
+
+	if server.Calls("/keys/rotating") < calls+2 {
+		t.Error("Expected the set to be refreshed in background")
+	}
+	public, err := manager.GetRSAPublic("rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.N.Cmp(third.Key.(*rsa.PublicKey).N) != 0 {
+		t.Error("Expected the refreshed key")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	signing, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hydra returns both the private and the public halves
+	server.AddKeySet("mixed", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: signing, KeyID: "private:sig", Algorithm: "RS256", Use: "sig"},
+		{Key: &signing.PublicKey, KeyID: "public:sig", Algorithm: "RS256", Use: "sig"},
+		{Key: &encryption.PublicKey, KeyID: "public:enc", Algorithm: "RSA-OAEP-256", Use: "enc"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := manager.GetRSAPublic("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if public.N.Cmp(signing.N) != 0 {
+		t.Error("Expected the first public key")
+	}
+	private, err := manager.GetRSAPrivate("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private.D.Cmp(signing.D) != 0 {
+		t.Error("Expected the first private key")
+	}
+
+	key, err := manager.GetKey("mixed", "public:enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Algorithm != "RSA-OAEP-256" || key.Use != "enc" {
+		t.Errorf("Expected the metadata of the key, got %s %s", key.Algorithm, key.Use)
+	}
+
+	sig, err := manager.GetKeysByUse("mixed", "sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sig) != 2 {
+		t.Errorf("Expected 2 signing keys, got %d", len(sig))
+	}
+
+	set, err := manager.GetSet("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 3 {
+		t.Errorf("Expected 3 keys, got %d", len(set.Keys))
+	}
+	if calls := server.Calls("/keys/mixed"); calls != 1 {
+		t.Errorf("Expected the set to be fetched once, got %d", calls)
+	}
+
+	if _, err := manager.GetKey("mixed", "missing"); err == nil {
+		t.Error("Expected an error for a missing key")
+	}
+}
+
+// slowTransport delays the requests, so that the concurrent ones overlap
+type slowTransport struct {
+	base  http.RoundTripper
+	delay time.Duration
+}
+
+func (t slowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-time.After(t.delay):
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return t.base.RoundTrip(req)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("concurrent", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: key, KeyID: "private", Algorithm: "RS256", Use: "sig"},
+		{Key: &key.PublicKey, KeyID: "public", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Client.Transport = slowTransport{base: manager.Client.Transport, delay: 50 * time.Millisecond}
+
+	start := make(chan struct{})
+	errs := make(chan error, 100)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+
+			var err error
+			switch i % 4 {
+			case 0:
+				_, err = manager.GetRSAPublic("concurrent")
+			case 1:
+				_, err = manager.GetRSAPrivate("concurrent")
+			case 2:
+				_, err = manager.GetKey("concurrent", "public")
+			case 3:
+				_, err = manager.GetSigner("concurrent")
+			}
+			if err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	if calls := server.Calls("/keys/concurrent"); calls != 1 {
+		t.Errorf("Expected a single fetch with a cold cache, got %d", calls)
+	}
+
+	// Refreshes in the background and on unknown keys don't race with the readers
+	manager.RefreshInterval = 5 * time.Millisecond
+	manager.MinRefreshInterval = time.Nanosecond
+	manager.Start()
+	defer manager.Stop()
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				manager.GetKey("concurrent", "missing")
+				manager.GetRSAPublic("concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCanceledFetch(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("shared", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: "public", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Client.Transport = slowTransport{base: manager.Client.Transport, delay: 100 * time.Millisecond}
+
+	// The first caller starts the fetch and gives up before it ends
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := manager.GetKeyCtx(ctx, "shared", "public")
+		first <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	second := make(chan error, 1)
+	go func() {
+		_, err := manager.GetKeyCtx(context.Background(), "shared", "public")
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := <-first; err != context.Canceled {
+		t.Errorf("Expected the first caller to be canceled, got %v", err)
+	}
+	if err := <-second; err != nil {
+		t.Errorf("Expected the second caller to get the key, got %s", err)
+	}
+	if calls := server.Calls("/keys/shared"); calls != 1 {
+		t.Errorf("Expected a single fetch, got %d", calls)
+	}
+}
+
+func TestUnknownKeyRateLimit(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("limited", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: "public", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	connected, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A manager built without the constructor still limits the fetches of unknown keys
+	manager := &keys.CachedKeyManager{Endpoint: connected.Endpoint, Client: connected.Client}
+
+	for i := 0; i < 10; i++ {
+		if _, err := manager.GetKey("limited", "unknown"); err == nil {
+			t.Fatal("Expected an unknown key to be missing")
+		}
+	}
+	if calls := server.Calls("/keys/limited"); calls != 1 {
+		t.Errorf("Expected a single fetch, got %d", calls)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddKeySet("slow", jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: "public", Algorithm: "RS256", Use: "sig"},
+	}})
+
+	manager, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Client.Transport = slowTransport{base: manager.Client.Transport, delay: 200 * time.Millisecond}
+	manager.FetchTimeout = 50 * time.Millisecond
+
+	// The shared fetch gives up after FetchTimeout, even if the caller would wait longer
+	start := time.Now()
+	if _, err := manager.GetKeyCtx(context.Background(), "slow", "public"); err == nil {
+		t.Error("Expected the fetch to time out")
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("Expected to give up after the fetch timeout, waited %s", elapsed)
+	}
+}
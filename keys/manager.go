@@ -0,0 +1,264 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// Manager uses hydra rest apis to create, import and delete json web keys.
+// Unlike CachedKeyManager it doesn't cache anything: a CachedKeyManager reading the same
+// sets sees the changes at the next refresh.
+type Manager struct {
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	Client         *http.Client
+}
+
+// NewManager returns a Manager connected to the hydra cluster
+// it can fail if the cluster is not a valid url, or if the id and secret don't work
+func NewManager(id, secret, cluster string) (*Manager, error) {
+	return NewManagerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewManagerWithOptions returns a Manager connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewManagerWithOptions(cluster string, opts ...common.Option) (*Manager, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Instantiate Manager")
+	}
+
+	manager := Manager{
+		Endpoint:       common.JoinURL(endpoint, "keys"),
+		HealthEndpoint: common.JoinURL(endpoint, "health", "status"),
+		Client:         client,
+	}
+	return &manager, nil
+}
+
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Manager) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
+// Get queries the hydra api to retrieve all the keys of a set
+func (m *Manager) Get(set string) (jose.JSONWebKeySet, error) {
+	return m.GetCtx(context.Background(), set)
+}
+
+// GetCtx is like Get, but the request is bound to the given context
+func (m *Manager) GetCtx(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	url := common.JoinURL(m.Endpoint, set).String()
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	var keyset jose.JSONWebKeySet
+
+	err = common.Bind(m.Client, req, &keyset)
+	if err != nil {
+		return jose.JSONWebKeySet{}, err
+	}
+	return keyset, nil
+}
+
+// Create asks hydra to generate a new key in the set, creating the set if it doesn't exist.
+// alg is the algorithm of the key (for example RS256, ES256 or HS256), use is sig or enc,
+// and kid can be left empty to let hydra choose one. It returns the generated keys, which for
+// the asymmetric algorithms are both the private and the public halves.
+func (m *Manager) Create(set, alg, kid, use string) (jose.JSONWebKeySet, error) {
+	return m.CreateCtx(context.Background(), set, alg, kid, use)
+}
+
+// CreateCtx is like Create, but the request is bound to the given context
+func (m *Manager) CreateCtx(ctx context.Context, set, alg, kid, use string) (jose.JSONWebKeySet, error) {
+	url := common.JoinURL(m.Endpoint, set).String()
+
+	payload, err := json.Marshal(createRequest{Algorithm: alg, KeyID: kid, Use: use})
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "json marshal of %s", alg)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	var keyset jose.JSONWebKeySet
+
+	err = common.Bind(m.Client, req, &keyset)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "Create %s", set)
+	}
+	return keyset, nil
+}
+
+// Import uploads a key generated elsewhere to the set, replacing the key with the same id.
+// The key must have a KeyID.
+func (m *Manager) Import(set string, key jose.JSONWebKey) error {
+	return m.ImportCtx(context.Background(), set, key)
+}
+
+// ImportCtx is like Import, but the request is bound to the given context
+func (m *Manager) ImportCtx(ctx context.Context, set string, key jose.JSONWebKey) error {
+	if key.KeyID == "" {
+		return errors.New("Import: the key has no KeyID")
+	}
+	url := common.JoinURL(m.Endpoint, set, key.KeyID).String()
+
+	payload, err := json.Marshal(key)
+	if err != nil {
+		return errors.Wrapf(err, "json marshal of %s", key.KeyID)
+	}
+
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(payload))
+	if err != nil {
+		return errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	err = common.Bind(m.Client, req, &key)
+	if err != nil {
+		return errors.Wrapf(err, "Import %s", key.KeyID)
+	}
+	return nil
+}
+
+// Delete queries the hydra api to remove the keys with the given id from the set
+func (m *Manager) Delete(set, kid string) error {
+	return m.DeleteCtx(context.Background(), set, kid)
+}
+
+// DeleteCtx is like Delete, but the request is bound to the given context
+func (m *Manager) DeleteCtx(ctx context.Context, set, kid string) error {
+	return m.delete(ctx, common.JoinURL(m.Endpoint, set, kid).String())
+}
+
+// DeleteSet queries the hydra api to remove the whole set
+func (m *Manager) DeleteSet(set string) error {
+	return m.DeleteSetCtx(context.Background(), set)
+}
+
+// DeleteSetCtx is like DeleteSet, but the request is bound to the given context
+func (m *Manager) DeleteSetCtx(ctx context.Context, set string) error {
+	return m.delete(ctx, common.JoinURL(m.Endpoint, set).String())
+}
+
+// Rotate generates a new key in the set for each distinct algorithm and use of the current keys,
+// and then removes the old keys with the same algorithm and use. The new keys are added first,
+// so that the set is never empty. The keys without an algorithm are left untouched.
+// It returns the generated keys.
+func (m *Manager) Rotate(set string) (jose.JSONWebKeySet, error) {
+	return m.RotateCtx(context.Background(), set)
+}
+
+// RotateCtx is like Rotate, but the requests are bound to the given context
+func (m *Manager) RotateCtx(ctx context.Context, set string) (jose.JSONWebKeySet, error) {
+	old, err := m.GetCtx(ctx, set)
+	if err != nil {
+		return jose.JSONWebKeySet{}, errors.Wrapf(err, "Rotate %s", set)
+	}
+
+	// The kinds of keys to rotate, in the order they appear in the set
+	type kind struct{ alg, use string }
+	kinds := []kind{}
+	rotated := map[kind]bool{}
+	for _, key := range old.Keys {
+		k := kind{key.Algorithm, key.Use}
+		if key.Algorithm != "" && !rotated[k] {
+			kinds = append(kinds, k)
+			rotated[k] = true
+		}
+	}
+	if len(kinds) == 0 {
+		return jose.JSONWebKeySet{}, errors.Errorf("Rotate %s: no key with an algorithm in the set", set)
+	}
+
+	created := jose.JSONWebKeySet{}
+	for _, k := range kinds {
+		keyset, err := m.CreateCtx(ctx, set, k.alg, "", k.use)
+		if err != nil {
+			return created, errors.Wrapf(err, "Rotate %s", set)
+		}
+		created.Keys = append(created.Keys, keyset.Keys...)
+	}
+
+	// Hydra deletes by id, so an id shared with a key that is not rotated must be kept
+	kept := map[string]bool{}
+	for _, key := range old.Keys {
+		if !rotated[kind{key.Algorithm, key.Use}] {
+			kept[key.KeyID] = true
+		}
+	}
+
+	deleted := map[string]bool{}
+	for _, key := range old.Keys {
+		if kept[key.KeyID] || deleted[key.KeyID] || len(created.Key(key.KeyID)) > 0 {
+			continue
+		}
+		err := m.DeleteCtx(ctx, set, key.KeyID)
+		if err != nil && !common.IsNotFound(err) {
+			return created, errors.Wrapf(err, "Rotate %s", set)
+		}
+		deleted[key.KeyID] = true
+	}
+	return created, nil
+}
+
+// delete sends a DELETE request to the url
+func (m *Manager) delete(ctx context.Context, url string) error {
+	req, err := http.NewRequest("DELETE", url, nil)
+	if err != nil {
+		return errors.Wrapf(err, "new request for %s", url)
+	}
+	req = req.WithContext(ctx)
+
+	return common.Bind(m.Client, req, nil)
+}
+
+// createRequest is the payload hydra expects to generate a key
+type createRequest struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+}
@@ -0,0 +1,211 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+func TestManager(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := manager.Create("signing", "ES256", "first", "sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Keys) != 2 {
+		t.Fatalf("Expected the private and the public key, got %d keys", len(created.Keys))
+	}
+	for _, key := range created.Keys {
+		if key.KeyID != "first" || key.Algorithm != "ES256" || key.Use != "sig" {
+			t.Errorf("Expected the requested metadata, got %s %s %s", key.KeyID, key.Algorithm, key.Use)
+		}
+	}
+
+	external, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Import("signing", jose.JSONWebKey{Key: &external.PublicKey, KeyID: "external", Algorithm: "ES256", Use: "sig"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Import("signing", jose.JSONWebKey{Key: &external.PublicKey}); err == nil {
+		t.Error("Expected an error importing a key without id")
+	}
+
+	keyset, err := manager.Get("signing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyset.Keys) != 3 || len(keyset.Key("external")) != 1 {
+		t.Errorf("Expected the imported key in the set, got %d keys", len(keyset.Keys))
+	}
+
+	if err := manager.Delete("signing", "external"); err != nil {
+		t.Error(err)
+	}
+	if err := manager.Delete("signing", "external"); !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	if err := manager.DeleteSet("signing"); err != nil {
+		t.Error(err)
+	}
+	if _, err := manager.Get("signing"); !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+
+	if _, err := manager.Create("signing", "none", "", "sig"); err == nil {
+		t.Error("Expected an error with an unknown algorithm")
+	}
+}
+
+func TestManagerRotate(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.MinRefreshInterval = time.Nanosecond
+
+	if _, err := manager.Create("rotating", "ES256", "old", "sig"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cached.GetKey("rotating", "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := manager.Rotate("rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Keys) != 2 {
+		t.Fatalf("Expected the private and the public key, got %d keys", len(created.Keys))
+	}
+	kid := created.Keys[0].KeyID
+	if kid == "old" || created.Keys[0].Algorithm != "ES256" || created.Keys[0].Use != "sig" {
+		t.Errorf("Expected a new key like the old one, got %s %s %s", kid, created.Keys[0].Algorithm, created.Keys[0].Use)
+	}
+
+	keyset, err := manager.Get("rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyset.Keys) != 2 || len(keyset.Key(kid)) != 2 {
+		t.Errorf("Expected only the new keys in the set, got %d keys", len(keyset.Keys))
+	}
+
+	// The cached manager picks up the new key on a miss, and keeps the old one for a while
+	if _, err := cached.GetKey("rotating", kid); err != nil {
+		t.Error(err)
+	}
+	if _, err := cached.GetKey("rotating", "old"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := manager.Rotate("missing"); !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
+
+func TestManagerRotateMixed(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Create("mixed", "ES256", "signing", "sig"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Create("mixed", "RSA-OAEP-256", "encryption", "enc"); err != nil {
+		t.Fatal(err)
+	}
+	external, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.Import("mixed", jose.JSONWebKey{Key: &external.PublicKey, KeyID: "external"}); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := manager.Rotate("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Keys) != 4 {
+		t.Fatalf("Expected a new key pair for each kind, got %d keys", len(created.Keys))
+	}
+
+	keyset, err := manager.Get("mixed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyset.Key("signing")) != 0 || len(keyset.Key("encryption")) != 0 {
+		t.Error("Expected the old keys to be removed")
+	}
+	if len(keyset.Key("external")) != 1 {
+		t.Error("Expected the key without algorithm to be kept")
+	}
+
+	kinds := map[string]int{}
+	for _, key := range keyset.Keys {
+		if key.KeyID != "external" {
+			kinds[key.Algorithm+" "+key.Use]++
+		}
+	}
+	if kinds["ES256 sig"] != 2 || kinds["RSA-OAEP-256 enc"] != 2 || len(kinds) != 2 {
+		t.Errorf("Expected a signing and an encryption key pair, got %v", kinds)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/net/context"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// Signer signs JWS payloads and JWT claims with the current private key of a hydra set,
+// setting its kid in the header. The current key is the last one of the set suitable for
+// the algorithm, since hydra appends the keys it creates: a new key is used right away,
+// even if the old one isn't deleted. The key is read from the cache of the manager at every
+// signature, so the keys rotated by hydra are used as soon as the manager refreshes the set.
+//
+//	signer := keys.NewSigner(manager, "my-service", jose.ES256)
+//	token, err := signer.SignClaims(jwt.Claims{Subject: "me"})
+type Signer struct {
+	Keys      *CachedKeyManager
+	Set       string
+	Algorithm jose.SignatureAlgorithm
+}
+
+// NewSigner returns a Signer using the keys of the set. The supported algorithms are
+// RS256, PS256, ES256 and EdDSA.
+func NewSigner(manager *CachedKeyManager, set string, alg jose.SignatureAlgorithm) *Signer {
+	return &Signer{
+		Keys:      manager,
+		Set:       set,
+		Algorithm: alg,
+	}
+}
+
+// Sign returns the compact serialization of a JWS of the payload
+func (s *Signer) Sign(payload []byte) (string, error) {
+	return s.SignCtx(context.Background(), payload)
+}
+
+// SignCtx is like Sign, but retrieving the key is bound to the given context
+func (s *Signer) SignCtx(ctx context.Context, payload []byte) (string, error) {
+	signer, err := s.signer(ctx, "")
+	if err != nil {
+		return "", err
+	}
+
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		return "", errors.Wrapf(err, "sign with set %s", s.Set)
+	}
+	return jws.CompactSerialize()
+}
+
+// SignClaims returns a JWT containing all the claims, which can be jwt.Claims,
+// maps or structs marshalled as json objects
+func (s *Signer) SignClaims(claims ...interface{}) (string, error) {
+	return s.SignClaimsCtx(context.Background(), claims...)
+}
+
+// SignClaimsCtx is like SignClaims, but retrieving the key is bound to the given context
+func (s *Signer) SignClaimsCtx(ctx context.Context, claims ...interface{}) (string, error) {
+	signer, err := s.signer(ctx, "JWT")
+	if err != nil {
+		return "", err
+	}
+
+	builder := jwt.Signed(signer)
+	for _, c := range claims {
+		builder = builder.Claims(c)
+	}
+	token, err := builder.CompactSerialize()
+	if err != nil {
+		return "", errors.Wrapf(err, "sign with set %s", s.Set)
+	}
+	return token, nil
+}
+
+// signer returns a jose.Signer with the last private key of the set suitable for the algorithm.
+// typ, if not empty, is set in the header
+func (s *Signer) signer(ctx context.Context, typ jose.ContentType) (jose.Signer, error) {
+	keyset, err := s.Keys.getSet(ctx, s.Set)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(keyset.Keys) - 1; i >= 0; i-- {
+		key := keyset.Keys[i]
+		if key.IsPublic() || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != string(s.Algorithm) {
+			continue
+		}
+		if !suitable(s.Algorithm, key.Key) {
+			continue
+		}
+
+		opts := (&jose.SignerOptions{}).WithHeader("kid", key.KeyID)
+		if typ != "" {
+			opts = opts.WithType(typ)
+		}
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: s.Algorithm, Key: key.Key}, opts)
+		if err != nil {
+			return nil, errors.Wrapf(err, "new signer with key %s", key.KeyID)
+		}
+		return signer, nil
+	}
+	return nil, errors.Errorf("No private key for %s in set %s", s.Algorithm, s.Set)
+}
+
+// suitable tells if the key can sign with the algorithm
+func suitable(alg jose.SignatureAlgorithm, key interface{}) bool {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return alg == jose.RS256 || alg == jose.PS256
+	case *ecdsa.PrivateKey:
+		return alg == jose.ES256 && key.Curve == elliptic.P256()
+	case ed25519.PrivateKey:
+		return alg == jose.EdDSA
+	default:
+		return false
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * This file is part of hydrasdk
+ *
+ * hydrasdk is free software; you can redistribute it and/or modify
+ * it under the terms of the GNU General Public License as published by
+ * the Free Software Foundation; either version 2 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU General Public License for more details.
+ *
+ * You should have received a copy of the GNU General Public License
+ * along with this program; if not, write to the Free Software
+ * Foundation, Inc., 51 Franklin St, Fifth Floor, Boston, MA  02110-1301  USA
+ *
+ * As a special exception, you may use this file as part of a free software
+ * library without restriction.  Specifically, if other files instantiate
+ * templates or use macros or inline functions from this file, or you compile
+ * this file and link it with other files to produce an executable, this
+ * file does not by itself cause the resulting executable to be covered by
+ * the GNU General Public License.  This exception does not however
+ * invalidate any other reasons why the executable file might be covered by
+ * the GNU General Public License.
+ *
+ * Copyright 2017 ARDUINO AG (http://www.arduino.cc/)
+ */
+
+package keys_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bcmi-labs/hydrasdk/hydratest"
+	"github.com/bcmi-labs/hydrasdk/keys"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func TestSigner(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.RefreshInterval = 10 * time.Millisecond
+
+	for _, alg := range []string{"RS256", "PS256", "ES256"} {
+		if _, err := manager.Create(alg, alg, "", "sig"); err != nil {
+			t.Fatal(err)
+		}
+
+		signer := keys.NewSigner(cached, alg, jose.SignatureAlgorithm(alg))
+		token, err := signer.SignClaims(jwt.Claims{Subject: "me"}, map[string]interface{}{"scp": []string{"items"}})
+		if err != nil {
+			t.Errorf("%s: %s", alg, err)
+			continue
+		}
+
+		parsed, err := jwt.ParseSigned(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := parsed.Headers[0]
+		if header.Algorithm != alg {
+			t.Errorf("%s: Expected the algorithm in the header, got %s", alg, header.Algorithm)
+		}
+		key, err := cached.GetKey(alg, header.KeyID)
+		if err != nil {
+			t.Fatalf("%s: %s", alg, err)
+		}
+		public := key.Public()
+		var claims jwt.Claims
+		if err := parsed.Claims(public.Key, &claims); err != nil {
+			t.Errorf("%s: %s", alg, err)
+		}
+		if claims.Subject != "me" {
+			t.Errorf("%s: Expected the subject, got %s", alg, claims.Subject)
+		}
+
+		jws, err := signer.Sign([]byte("payload"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		object, err := jose.ParseSigned(jws)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := object.Verify(public.Key)
+		if err != nil || string(payload) != "payload" {
+			t.Errorf("%s: Expected the payload to be verified, got %s %v", alg, payload, err)
+		}
+	}
+
+	// A signer with the wrong algorithm has no suitable key
+	if _, err := keys.NewSigner(cached, "ES256", jose.RS256).Sign([]byte("payload")); err == nil {
+		t.Error("Expected an error without a suitable key")
+	}
+}
+
+func TestSignerRotation(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := keys.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := keys.NewCachedKeyManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached.RefreshInterval = 10 * time.Millisecond
+
+	if _, err := manager.Create("rotating", "ES256", "old", "sig"); err != nil {
+		t.Fatal(err)
+	}
+	signer := keys.NewSigner(cached, "rotating", jose.ES256)
+	if kid := signedKeyID(t, signer); kid != "old" {
+		t.Errorf("Expected the old key, got %s", kid)
+	}
+
+	// A key added to the set becomes the current one, even if the old key is still there
+	added, err := manager.Create("rotating", "ES256", "", "sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if kid := signedKeyID(t, signer); kid != added.Keys[0].KeyID {
+		t.Errorf("Expected the added key %s, got %s", added.Keys[0].KeyID, kid)
+	}
+
+	created, err := manager.Rotate("rotating")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if kid := signedKeyID(t, signer); kid != created.Keys[0].KeyID {
+		t.Errorf("Expected the rotated key %s, got %s", created.Keys[0].KeyID, kid)
+	}
+}
+
+func signedKeyID(t *testing.T, signer *keys.Signer) string {
+	token, err := signer.SignClaims(jwt.Claims{Subject: "me"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Headers[0].KeyID
+}
@@ -37,12 +37,14 @@ import (
 
 	"github.com/bcmi-labs/hydrasdk/common"
 	"github.com/pkg/errors"
+	"golang.org/x/net/context"
 )
 
 // Manager provides methods to create and update ladon policies
 type Manager struct {
-	Endpoint *url.URL
-	Client   *http.Client
+	Endpoint       *url.URL
+	HealthEndpoint *url.URL
+	Client         *http.Client
 }
 
 // Policy allows or denies certain Subjects to perform certain Actions on certain Resources.
@@ -60,19 +62,36 @@ type Policy struct {
 // NewManager returns a Manager connected to the hydra cluster
 // it can fail if the cluster is not a valid url, or if the id and secret don't work
 func NewManager(id, secret, cluster string) (*Manager, error) {
-	endpoint, client, err := common.Authenticate(id, secret, cluster, "hydra")
+	return NewManagerWithOptions(cluster, common.WithClientCredentials(id, secret, "hydra"))
+}
+
+// NewManagerWithOptions returns a Manager connected to the hydra cluster, authenticated according to the options
+// it can fail if the cluster is not a valid url, or if the authentication doesn't work
+func NewManagerWithOptions(cluster string, opts ...common.Option) (*Manager, error) {
+	endpoint, client, err := common.Connect(cluster, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "Instantiate ClientManager")
 	}
 	manager := Manager{
-		Endpoint: common.JoinURL(endpoint, "policies"),
-		Client:   client,
+		Endpoint:       common.JoinURL(endpoint, "policies"),
+		HealthEndpoint: common.JoinURL(endpoint, "health", "status"),
+		Client:         client,
 	}
 	return &manager, nil
 }
 
+// Ping checks that the hydra cluster is reachable and that the authentication works
+func (m *Manager) Ping(ctx context.Context) error {
+	return common.Ping(ctx, m.Client, m.HealthEndpoint)
+}
+
 // Create calls the hydra api to create a new policy
 func (m *Manager) Create(policy *Policy) error {
+	return m.CreateCtx(context.Background(), policy)
+}
+
+// CreateCtx is like Create, but the request is bound to the given context
+func (m *Manager) CreateCtx(ctx context.Context, policy *Policy) error {
 	url := m.Endpoint.String()
 
 	payload, err := json.Marshal(policy)
@@ -84,6 +103,7 @@ func (m *Manager) Create(policy *Policy) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, &policy)
 	if err != nil {
@@ -94,6 +114,11 @@ func (m *Manager) Create(policy *Policy) error {
 
 // Update calls the hydra api to update a specific policy
 func (m *Manager) Update(id string, policy *Policy) error {
+	return m.UpdateCtx(context.Background(), id, policy)
+}
+
+// UpdateCtx is like Update, but the request is bound to the given context
+func (m *Manager) UpdateCtx(ctx context.Context, id string, policy *Policy) error {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	payload, err := json.Marshal(policy)
@@ -105,6 +130,7 @@ func (m *Manager) Update(id string, policy *Policy) error {
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -115,10 +141,16 @@ func (m *Manager) Update(id string, policy *Policy) error {
 
 // GetAll calls the hydra api to return all the policies
 func (m *Manager) GetAll() ([]Policy, error) {
+	return m.GetAllCtx(context.Background())
+}
+
+// GetAllCtx is like GetAll, but the request is bound to the given context
+func (m *Manager) GetAllCtx(ctx context.Context) ([]Policy, error) {
 	req, err := http.NewRequest("GET", m.Endpoint.String(), nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", m.Endpoint.String())
 	}
+	req = req.WithContext(ctx)
 
 	var policies []Policy
 
@@ -131,12 +163,18 @@ func (m *Manager) GetAll() ([]Policy, error) {
 
 // Get calls the hydra api to return a specific policy
 func (m *Manager) Get(id string) (*Policy, error) {
+	return m.GetCtx(context.Background(), id)
+}
+
+// GetCtx is like Get, but the request is bound to the given context
+func (m *Manager) GetCtx(ctx context.Context, id string) (*Policy, error) {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	var policy Policy
 
@@ -149,12 +187,18 @@ func (m *Manager) Get(id string) (*Policy, error) {
 
 // Delete calls the hydra api to remove a specific policy
 func (m *Manager) Delete(id string) error {
+	return m.DeleteCtx(context.Background(), id)
+}
+
+// DeleteCtx is like Delete, but the request is bound to the given context
+func (m *Manager) DeleteCtx(ctx context.Context, id string) error {
 	url := common.JoinURL(m.Endpoint, id).String()
 
 	req, err := http.NewRequest("DELETE", url, nil)
 	if err != nil {
 		return errors.Wrapf(err, "new request for %s", url)
 	}
+	req = req.WithContext(ctx)
 
 	err = common.Bind(m.Client, req, nil)
 	if err != nil {
@@ -30,13 +30,19 @@
 package policies_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/bcmi-labs/hydrasdk/common"
+	"github.com/bcmi-labs/hydrasdk/hydratest"
 	"github.com/bcmi-labs/hydrasdk/policies"
 )
 
 func TestGetPolicies(t *testing.T) {
-	manager, err := policies.NewManager("admin", "demo-password", "http://localhost:4444")
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := policies.NewManager("admin", "demo-password", server.URL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -61,7 +67,10 @@ func TestGetPolicies(t *testing.T) {
 }
 
 func TestCreatePolicy(t *testing.T) {
-	manager, err := policies.NewManager("admin", "demo-password", "http://localhost:4444")
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := policies.NewManager("admin", "demo-password", server.URL)
 	if err != nil {
 		t.Error(err)
 	}
@@ -81,12 +90,42 @@ func TestCreatePolicy(t *testing.T) {
 	}
 
 	policy, err := manager.Get(payload.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if policy.ID != payload.ID {
 		t.Errorf("Expected ID='%s', got %s", payload.ID, policy.ID)
 	}
 
 	cleanPolicies(manager)
 
+	_, err = manager.Get(payload.ID)
+	if !common.IsNotFound(err) {
+		t.Errorf("Expected a not found error retrieving a deleted policy, got %v", err)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	server := hydratest.NewServer()
+	defer server.Close()
+
+	manager, err := policies.NewManager("admin", "demo-password", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = manager.GetAllCtx(ctx)
+	if err == nil {
+		t.Error("Expected an error with a canceled context")
+	}
+
+	_, err = manager.GetAllCtx(context.Background())
+	if err != nil {
+		t.Error(err)
+	}
 }
 
 func cleanPolicies(policies *policies.Manager) {